@@ -0,0 +1,203 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+)
+
+// enumerated constants that classify errors returned by DECS controller API
+const (
+	API_ERR_UNKNOWN        = iota // error that does not fall into any of the classes below
+	API_ERR_NOT_FOUND      = iota // requested object does not exist
+	API_ERR_UNAUTHORIZED   = iota // credential is missing, invalid or expired
+	API_ERR_FORBIDDEN      = iota // authenticated user has no rights for the requested operation
+	API_ERR_CONFLICT       = iota // operation conflicts with the current state of the object
+	API_ERR_QUOTA_EXCEEDED = iota // operation would exceed resource quota
+	API_ERR_TRANSIENT      = iota // controller is temporarily unable to process the request
+	API_ERR_SERVER         = iota // internal error on the controller side
+)
+
+var apiErrorKindNames = map[int]string{
+	API_ERR_UNKNOWN:        "unknown error",
+	API_ERR_NOT_FOUND:      "not found",
+	API_ERR_UNAUTHORIZED:   "unauthorized",
+	API_ERR_FORBIDDEN:      "forbidden",
+	API_ERR_CONFLICT:       "conflict",
+	API_ERR_QUOTA_EXCEEDED: "quota exceeded",
+	API_ERR_TRANSIENT:      "temporarily unavailable",
+	API_ERR_SERVER:         "server error",
+}
+
+// controller reports quota violations with different status codes, so we also look into the message
+var quotaMessageRe = regexp.MustCompile(`(?i)quota|limit\b.*\b(exceed|reach)|exceed.*\blimit|insufficient (resources|capacity)`)
+
+// error messages extracted from response body are truncated to this length
+const apiErrorMessageMaxLen = 512
+
+// DecsAPIError is returned by decsAPICall when DECS controller responds with status code other than 200.
+type DecsAPIError struct {
+	HTTPStatus int     // HTTP status code returned by the controller
+	API string         // API path, e.g. MachinesGetAPI
+	Message string     // error message extracted from the response body, with secrets redacted
+	Kind int           // error class, one of API_ERR_* constants
+	Params string      // API call parameters, with secrets redacted
+}
+
+func (e *DecsAPIError) Error() string {
+	msg := fmt.Sprintf("decsAPICall: API %q failed with status code %d (%s)",
+	                   e.API, e.HTTPStatus, apiErrorKindNames[e.Kind])
+	if e.Message != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Message)
+	}
+	if e.Params != "" {
+		msg = fmt.Sprintf("%s; request Body %q", msg, e.Params)
+	}
+	return msg
+}
+
+func newDecsAPIError(api_name string, status_code int, resp_body []byte, params string) *DecsAPIError {
+	message := apiErrorMessage(resp_body)
+	return &DecsAPIError{
+		HTTPStatus: status_code,
+		API:        api_name,
+		Message:    message,
+		Kind:       classifyAPIError(status_code, message),
+		Params:     params,
+	}
+}
+
+func apiErrorMessage(resp_body []byte) string {
+	// Extract error message from the body of failed API call response. Controller may return plain text,
+	// JSON encoded string or a dictionary with the message in one of its fields.
+	body_str := strings.TrimSpace(string(resp_body))
+	if body_str == "" {
+		return ""
+	}
+
+	message := body_str
+	var str_value string
+	var dict_value map[string]interface{}
+	json_body, err := Jo2JSON(body_str)
+	if err != nil {
+		// not a Python literal, most probably plain text or HTML error page
+	} else if json.Unmarshal([]byte(json_body), &str_value) == nil {
+		message = str_value
+	} else if json.Unmarshal([]byte(json_body), &dict_value) == nil {
+		for _, key := range []string{"message", "error", "msg", "detail"} {
+			if field_value, ok := dict_value[key].(string); ok && field_value != "" {
+				message = field_value
+				break
+			}
+		}
+	}
+
+	message = redactText(strings.TrimSpace(message))
+	if len(message) > apiErrorMessageMaxLen {
+		message = message[:apiErrorMessageMaxLen] + "..."
+	}
+	return message
+}
+
+func classifyAPIError(status_code int, message string) int {
+	if status_code >= 400 && status_code < 500 && quotaMessageRe.MatchString(message) {
+		return API_ERR_QUOTA_EXCEEDED
+	}
+
+	switch status_code {
+	case http.StatusNotFound:
+		return API_ERR_NOT_FOUND
+	case http.StatusUnauthorized, 419:
+		return API_ERR_UNAUTHORIZED
+	case http.StatusForbidden:
+		return API_ERR_FORBIDDEN
+	case http.StatusConflict:
+		return API_ERR_CONFLICT
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return API_ERR_TRANSIENT
+	}
+
+	if status_code >= 500 {
+		return API_ERR_SERVER
+	}
+	return API_ERR_UNKNOWN
+}
+
+func apiErrorKind(err error) int {
+	// Return class of the error if it was returned by DECS controller API, otherwise API_ERR_UNKNOWN.
+	var api_err *DecsAPIError
+	if errors.As(err, &api_err) {
+		return api_err.Kind
+	}
+	return API_ERR_UNKNOWN
+}
+
+func isNotFoundError(err error) bool {
+	return apiErrorKind(err) == API_ERR_NOT_FOUND
+}
+
+func isQuotaError(err error) bool {
+	return apiErrorKind(err) == API_ERR_QUOTA_EXCEEDED
+}
+
+func isContextError(err error) bool {
+	// Check if the error means that the operation was cancelled or its timeout has expired.
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func explainAPIError(err error, action string) error {
+	// Wrap error returned by DECS controller API with the explanation of what failed and what the user
+	// can do about it. Operation timeout and cancellation are reported along with the action that was
+	// in progress. Errors of other types are returned as is.
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("Timed out while trying to %s. Increase operation timeout in the resource configuration if DECS controller is slow. %w",
+		                  action, err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("Operation cancelled while trying to %s: %w", action, err)
+	}
+
+	var api_err *DecsAPIError
+	if !errors.As(err, &api_err) {
+		return err
+	}
+
+	switch api_err.Kind {
+	case API_ERR_QUOTA_EXCEEDED:
+		return fmt.Errorf("Cannot %s: resource quota exceeded. Increase quotas of the resource group or its tenant, or request less resources. %s",
+		                  action, api_err)
+	case API_ERR_FORBIDDEN:
+		return fmt.Errorf("Cannot %s: access denied. Check access rights of the user the provider is authenticated as. %s",
+		                  action, api_err)
+	case API_ERR_UNAUTHORIZED:
+		return fmt.Errorf("Cannot %s: DECS controller rejected provider credentials. %s", action, api_err)
+	case API_ERR_CONFLICT:
+		return fmt.Errorf("Cannot %s: operation conflicts with the current state of the object. %s", action, api_err)
+	case API_ERR_TRANSIENT:
+		return fmt.Errorf("Cannot %s: DECS controller is temporarily unavailable, please try again later. %s", action, api_err)
+	}
+	return fmt.Errorf("Cannot %s: %s", action, api_err)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/terraform-provider-decs/decs/client"
+
+)
+
+// Responses of the list APIs are kept for this long. Terraform refreshes every resource and data
+// source separately, and most of them look up their objects in the same lists, so a short lived
+// cache saves a lot of identical calls within a single run.
+var apiCacheTTL = time.Second * 30
+
+// list APIs whose responses are cached
+var cacheableAPIs = map[string]bool{
+	client.TenantsListAPI:      true,
+	client.CloudspacesListAPI:  true,
+	client.ImagesListAPI:       true,
+	client.MachinesListAPI:     true,
+	client.PortforwardsListAPI: true,
+}
+
+// Modifying objects of one API family may also change the lists of another family, e.g. deleting
+// a resource group destroys its VMs and their port forwarding rules.
+var dependentAPIFamilies = map[string][]string{
+	"/restmachine/cloudapi/cloudspaces": {"/restmachine/cloudapi/machines", "/restmachine/cloudapi/portforwarding"},
+	"/restmachine/cloudapi/machines":    {"/restmachine/cloudapi/portforwarding"},
+}
+
+func apiFamily(api_name string) string {
+	// API family is the API name without its verb, e.g. "/restmachine/cloudapi/machines"
+	return api_name[:strings.LastIndex(api_name, "/")]
+}
+
+type apiCacheEntry struct {
+	api_name string
+	done chan struct{}   // closed when the response is available
+	json_resp string
+	err error
+	expires time.Time
+	generation int       // generation of the API family at the moment the call was started
+}
+
+// apiCache keeps responses of the list APIs for the duration of apiCacheTTL. Concurrent identical
+// calls are collapsed into one, so that refreshing many resources in parallel does not hit the
+// controller with the same request many times over. Any modifying call invalidates cached lists
+// of its API family.
+type apiCache struct {
+	mutex sync.Mutex
+	entries map[string]*apiCacheEntry
+	generations map[string]int // incremented on every invalidation of the API family
+}
+
+func newAPICache(disabled bool) *apiCache {
+	// Return nil cache if caching is disabled.
+	if disabled {
+		return nil
+	}
+	return &apiCache{
+		entries:     make(map[string]*apiCacheEntry),
+		generations: make(map[string]int),
+	}
+}
+
+func (cache *apiCache) cacheable(api_name string) bool {
+	return cache != nil && cacheableAPIs[api_name]
+}
+
+func (cache *apiCache) get(ctx context.Context, method string, api_name string, url_values *url.Values, fetch func() (string, error)) (string, error) {
+	// Return cached response to the API call or call fetch() to obtain it. If the same call is 
+	// already running, wait for its result instead.
+	key := cassetteKey(method, api_name, url_values.Encode())
+	family := apiFamily(api_name)
+
+	cache.mutex.Lock()
+	entry, found := cache.entries[key]
+	if found && entry.isDone() && time.Now().After(entry.expires) {
+		delete(cache.entries, key)
+		found = false
+	}
+	if found {
+		cache.mutex.Unlock()
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if entry.err != nil && isContextError(entry.err) && ctx.Err() == nil {
+			// the call we waited for was abandoned by its own caller, so make the call once again
+			return cache.get(ctx, method, api_name, url_values, fetch)
+		}
+		log.Printf("apiCache: serving API %q from cache", api_name)
+		return entry.json_resp, entry.err
+	}
+	entry = &apiCacheEntry{api_name: api_name, done: make(chan struct{}), generation: cache.generations[family]}
+	cache.entries[key] = entry
+	cache.mutex.Unlock()
+
+	json_resp, err := fetch()
+
+	cache.mutex.Lock()
+	entry.json_resp, entry.err = json_resp, err
+	entry.expires = time.Now().Add(apiCacheTTL)
+	// failed calls are not cached, neither are the responses obtained before the family was invalidated
+	if (err != nil || entry.generation != cache.generations[family]) && cache.entries[key] == entry {
+		delete(cache.entries, key)
+	}
+	close(entry.done)
+	cache.mutex.Unlock()
+	return json_resp, err
+}
+
+func (entry *apiCacheEntry) isDone() bool {
+	select {
+	case <-entry.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (cache *apiCache) invalidate(api_name string) {
+	// Drop cached lists of the API family modified by the call and of the families depending on it.
+	if cache == nil {
+		return
+	}
+	families := append([]string{apiFamily(api_name)}, dependentAPIFamilies[apiFamily(api_name)]...)
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for _, family := range families {
+		cache.generations[family] += 1
+		for key, entry := range cache.entries {
+			if apiFamily(entry.api_name) == family {
+				delete(cache.entries, key)
+			}
+		}
+	}
+}
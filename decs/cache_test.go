@@ -0,0 +1,140 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+
+	"github.com/terraform-provider-decs/decs/client"
+)
+
+func TestAPICacheInvalidation(t *testing.T) {
+	cache := newAPICache(false)
+	fetches := make(map[string]int)
+	get := func(api_name string) {
+		_, err := cache.get(context.Background(), "POST", api_name, &url.Values{}, func() (string, error) {
+			fetches[api_name] += 1
+			return "[]", nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	lists := []string{client.CloudspacesListAPI, client.MachinesListAPI, client.PortforwardsListAPI}
+	expect := func(step string, want ...int) {
+		for i, api_name := range lists {
+			if fetches[api_name] != want[i] {
+				t.Errorf("%s: API %q fetched %d times, want %d", step, api_name, fetches[api_name], want[i])
+			}
+		}
+	}
+
+	for _, api_name := range append(lists, lists...) {
+		get(api_name)
+	}
+	expect("repeated lists", 1, 1, 1)
+
+	cache.invalidate(client.PortforwardingCreateAPI)
+	for _, api_name := range lists {
+		get(api_name)
+	}
+	expect("after portforwarding change", 1, 1, 2)
+
+	cache.invalidate(client.MachineCreateAPI)
+	for _, api_name := range lists {
+		get(api_name)
+	}
+	expect("after machines change", 1, 2, 3)
+
+	cache.invalidate(client.CloudspacesDeleteAPI)
+	for _, api_name := range lists {
+		get(api_name)
+	}
+	expect("after cloudspaces change", 2, 3, 4)
+}
+
+func TestAPICacheErrorNotCached(t *testing.T) {
+	cache := newAPICache(false)
+	fetches := 0
+	for i := 0; i < 2; i++ {
+		_, err := cache.get(context.Background(), "POST", client.TenantsListAPI, &url.Values{}, func() (string, error) {
+			fetches += 1
+			return "", fmt.Errorf("Controller is down.")
+		})
+		if err == nil {
+			t.Fatal("Error of the list API is not returned.")
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("Failed list API fetched %d times, want 2", fetches)
+	}
+}
+
+func testAccProviderConfigNoCache(fc *fakeController) string {
+	return fmt.Sprintf(`
+provider "decs" {
+  authenticator  = "legacy"
+  controller_url = %q
+  user           = %q
+  password       = %q
+  max_retries    = 0
+  disable_cache  = true
+}
+`, fc.URL(), fakeLegacyUser, fakeLegacyPassword)
+}
+
+func testAccCacheListCalls(t *testing.T, provider_config func(fc *fakeController) string) int {
+	// Read several resource groups of the same tenant and return the number of cloudspaces/list calls
+	fc := newFakeController()
+	defer fc.Close()
+	config := ""
+	for i := 0; i < 3; i++ {
+		fc.addCloudspace(fmt.Sprintf("tf-cached-rg-%d", i))
+		config += fmt.Sprintf(`
+data "decs_resgroup" "rg%d" {
+  name   = "tf-cached-rg-%d"
+  tenant = %q
+}
+`, i, i, fakeTenantName)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders(),
+		Steps: []resource.TestStep{
+			{
+				Config: provider_config(fc) + config,
+				Check:  resource.TestCheckResourceAttrSet("data.decs_resgroup.rg2", "id"),
+			},
+		},
+	})
+	return fc.callCount(client.CloudspacesListAPI)
+}
+
+func TestAccCacheListCalls(t *testing.T) {
+	cached := testAccCacheListCalls(t, testAccProviderConfigLegacy)
+	uncached := testAccCacheListCalls(t, testAccProviderConfigNoCache)
+	if cached >= uncached {
+		t.Errorf("Cached run made %d calls to list resource groups, uncached run made %d.", cached, uncached)
+	}
+}
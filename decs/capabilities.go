@@ -0,0 +1,136 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/terraform-provider-decs/decs/client"
+
+)
+
+// Different generations of DECS controller provide different sets of cloudapi endpoints. Capabilities
+// of the controller are detected from its API catalog on the first need and then used by resources to
+// reject at plan time configurations the controller cannot handle.
+const (
+	CAP_CLOUDSPACES       = "cloudspaces"       // resource groups implemented as legacy VDC cloudspaces with external IP
+	CAP_DATA_DISKS        = "data_disks"
+	CAP_PORTFORWARDING    = "portforwarding"
+	CAP_EXTERNAL_NETWORKS = "external_networks" // direct connection of VMs to external networks
+	CAP_VM_RESIZE         = "vm_resize"         // change of CPU count and RAM size of existing VM
+	CAP_DISK_RESIZE       = "disk_resize"       // growing data disk attached to VM
+)
+
+type capabilitySpec struct {
+	feature string     // human readable name of the feature for error messages
+	api string         // API, presence of which in the catalog means that the feature is supported
+}
+
+var capabilitySpecs = map[string]capabilitySpec{
+	CAP_CLOUDSPACES:       {"resource groups based on cloudspaces", client.ResgroupCreateAPI},
+	CAP_DATA_DISKS:        {"data disks", client.DiskCreateAPI},
+	CAP_PORTFORWARDING:    {"port forwarding rules", client.PortforwardingCreateAPI},
+	CAP_EXTERNAL_NETWORKS: {"external networks", client.AttachExternalNetworkAPI},
+	CAP_VM_RESIZE:         {"VM resize", client.MachineResizeAPI},
+	CAP_DISK_RESIZE:       {"data disk resize", client.DiskResizeAPI},
+}
+
+// Controllers that do not provide API catalog are assumed to be of the generation this provider
+// was originally written for
+var legacyCapabilities = []string{CAP_CLOUDSPACES, CAP_DATA_DISKS, CAP_PORTFORWARDING, CAP_EXTERNAL_NETWORKS, CAP_VM_RESIZE,
+                                 CAP_DISK_RESIZE}
+
+const apiVersionUnknown = "unknown"
+
+type apiCapabilities struct {
+	version string           // API version reported by the controller
+	supported map[string]bool // capability name -> supported
+}
+
+func apiCatalogPath(api_name string) string {
+	// API catalog may list paths either with or without /restmachine prefix
+	return strings.TrimPrefix(api_name, "/restmachine")
+}
+
+func newAPICapabilities(catalog *client.APICatalogResp) *apiCapabilities {
+	caps := &apiCapabilities{version: catalog.Info.Version, supported: make(map[string]bool)}
+	if caps.version == "" {
+		caps.version = apiVersionUnknown
+	}
+	paths := make(map[string]bool)
+	for path := range catalog.Paths {
+		paths[apiCatalogPath(strings.TrimRight(catalog.BasePath, "/") + path)] = true
+		paths[apiCatalogPath(path)] = true
+	}
+	for name, spec := range capabilitySpecs {
+		caps.supported[name] = paths[apiCatalogPath(spec.api)]
+	}
+	return caps
+}
+
+func newLegacyCapabilities() *apiCapabilities {
+	caps := &apiCapabilities{version: apiVersionUnknown, supported: make(map[string]bool)}
+	for _, name := range legacyCapabilities {
+		caps.supported[name] = true
+	}
+	return caps
+}
+
+func (ctrl *ControllerCfg) capabilities(ctx context.Context) (*apiCapabilities, error) {
+	// Return capabilities of the controller, detecting them on the first call. Failure to obtain API catalog
+	// for a reason other than its absence is returned as error, so that detection is repeated next time.
+	ctrl.caps_mutex.Lock()
+	defer ctrl.caps_mutex.Unlock()
+	if ctrl.caps != nil {
+		return ctrl.caps, nil
+	}
+
+	catalog, err := ctrl.api.System.Catalog(ctx)
+	if err != nil {
+		// catalog may be missing altogether or be restricted to administrators
+		if !isNotFoundError(err) && apiErrorKind(err) != API_ERR_FORBIDDEN {
+			return nil, explainAPIError(err, "detect capabilities of DECS controller")
+		}
+		log.Printf("capabilities: API catalog of DECS controller %q is not available, assuming legacy cloudapi", ctrl.endpoints.current())
+		ctrl.caps = newLegacyCapabilities()
+		return ctrl.caps, nil
+	}
+
+	ctrl.caps = newAPICapabilities(catalog)
+	log.Printf("capabilities: DECS controller %q API version %s, capabilities %v", 
+	           ctrl.endpoints.current(), ctrl.caps.version, ctrl.caps.supported)
+	return ctrl.caps, nil
+}
+
+func (ctrl *ControllerCfg) requireCapability(ctx context.Context, name string) error {
+	// Return error explaining which feature is missing if the controller does not have the capability.
+	caps, err := ctrl.capabilities(ctx)
+	if err != nil {
+		return err
+	}
+	if caps.supported[name] {
+		return nil
+	}
+	spec := capabilitySpecs[name]
+	return fmt.Errorf("Feature %q requires DECS controller version that provides API %q. Controller %q with API version %s does not provide it.",
+	                  spec.feature, spec.api, ctrl.endpoints.current(), caps.version)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+
+	"github.com/terraform-provider-decs/decs/client"
+)
+
+func TestCapabilitiesFromCatalog(t *testing.T) {
+	catalog := &client.APICatalogResp{
+		Info:     client.APICatalogInfo{Version: "3.1"},
+		BasePath: "/restmachine/",
+		Paths: map[string]interface{}{
+			"/cloudapi/cloudspaces/create":           nil,
+			"/cloudapi/machines/attachExternalNetwork": nil,
+		},
+	}
+	caps := newAPICapabilities(catalog)
+	if caps.version != "3.1" {
+		t.Errorf("API version %q, want %q", caps.version, "3.1")
+	}
+	expected := map[string]bool{
+		CAP_CLOUDSPACES:       true,
+		CAP_DATA_DISKS:        false,
+		CAP_PORTFORWARDING:    false,
+		CAP_EXTERNAL_NETWORKS: true,
+	}
+	for name, supported := range expected {
+		if caps.supported[name] != supported {
+			t.Errorf("Capability %q supported %t, want %t", name, caps.supported[name], supported)
+		}
+	}
+}
+
+func TestAccCapabilitiesLegacyController(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	fc.catalog_missing = true
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmConfig, fakeTenantName, fakeImageID, fakeExtNetID),
+				Check:  testAccCheckVmProvisioned(fc, "tf-acc-vm"),
+			},
+		},
+	})
+}
+
+func TestAccCapabilitiesMissingFeature(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	fc.removeAPI(client.PortforwardingCreateAPI)
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config:      testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmConfig, fakeTenantName, fakeImageID, fakeExtNetID),
+				ExpectError: regexp.MustCompile(`Feature "port forwarding rules" requires DECS controller version that provides API "/restmachine/cloudapi/portforwarding/create"`),
+			},
+		},
+	})
+	if count := fc.objectCount(); count != 0 {
+		t.Errorf("Fake DECS controller has %d objects after rejected plan, expected none.", count)
+	}
+}
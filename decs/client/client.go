@@ -0,0 +1,174 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package client provides typed access to DECS cloudapi. It does not depend on Terraform and
+can be used by any tool that talks to DECS controller.
+
+Transport and authentication are the job of the Caller. HTTPCaller is a basic Caller for tools
+that do not need anything beyond a single controller URL and a pre-obtained session key or JWT.
+Controller responses, which are Python literals rather than JSON, are converted by PyLiteralToJSON.
+*/
+package client
+
+import (
+
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+)
+
+// Caller makes a single call to DECS cloudapi. It returns the response body as is on success. The call should be abandoned once ctx is done. Errors returned by Caller are passed
+// to the user of the client unchanged.
+type Caller interface {
+	CallAPI(ctx context.Context, method string, api_name string, url_values *url.Values) (string, error)
+}
+
+// Client groups typed methods of DECS cloudapi by the kind of object they manage.
+type Client struct {
+	caller Caller
+
+	Accounts *AccountsService
+	Cloudspaces *CloudspacesService
+	Disks *DisksService
+	Images *ImagesService
+	Machines *MachinesService
+	Portforwarding *PortforwardingService
+	System *SystemService
+}
+
+func New(caller Caller) *Client {
+	client := &Client{caller: caller}
+	client.Accounts = &AccountsService{client: client}
+	client.Cloudspaces = &CloudspacesService{client: client}
+	client.Disks = &DisksService{client: client}
+	client.Images = &ImagesService{client: client}
+	client.Machines = &MachinesService{client: client}
+	client.Portforwarding = &PortforwardingService{client: client}
+	client.System = &SystemService{client: client}
+	return client
+}
+
+func (client *Client) call(ctx context.Context, api_name string, url_values *url.Values, result interface{}) error {
+	// Call the API and decode its response into result. If result is nil, the response is discarded.
+	body_string, err := client.caller.CallAPI(ctx, "POST", api_name, url_values)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	json_string, err := PyLiteralToJSON(body_string)
+	if err != nil {
+		return fmt.Errorf("Cannot decode response of API %q: %s", api_name, err)
+	}
+	err = json.Unmarshal([]byte(json_string), result)
+	if err != nil {
+		return fmt.Errorf("Cannot decode response of API %q: %s", api_name, err)
+	}
+	return nil
+}
+
+func (client *Client) callForID(ctx context.Context, api_name string, url_values *url.Values) (int, error) {
+	// Call the API, which plainly returns ID of the created object on success.
+	body_string, err := client.caller.CallAPI(ctx, "POST", api_name, url_values)
+	if err != nil {
+		return 0, err
+	}
+	json_string, err := PyLiteralToJSON(body_string)
+	if err != nil {
+		return 0, fmt.Errorf("Cannot decode object ID returned by API %q: %s", api_name, err)
+	}
+	id, err := strconv.Atoi(strings.Trim(strings.TrimSpace(json_string), "\""))
+	if err != nil {
+		return 0, fmt.Errorf("Cannot decode object ID returned by API %q: %s", api_name, err)
+	}
+	return id, nil
+}
+
+func encodeParams(param interface{}) *url.Values {
+	// Convert parameter structure to API call arguments named by the json tags of its fields.
+	// Fields tagged with omitempty are skipped when they have zero value, nil pointer fields are
+	// always skipped and non-nil ones are passed by the value they point to. Slices are passed
+	// as JSON lists.
+	url_values := &url.Values{}
+	value := reflect.Indirect(reflect.ValueOf(param))
+	for i := 0; i < value.NumField(); i++ {
+		tag := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		omit_empty := false
+		for _, option := range tag[1:] {
+			if option == "omitempty" {
+				omit_empty = true
+			}
+		}
+		field := value.Field(i)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		} else if omit_empty && isEmptyParam(field) {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			url_values.Add(name, fmt.Sprintf("%d", field.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			url_values.Add(name, fmt.Sprintf("%d", field.Uint()))
+		case reflect.Float32, reflect.Float64:
+			url_values.Add(name, fmt.Sprintf("%f", field.Float()))
+		case reflect.Bool:
+			url_values.Add(name, strconv.FormatBool(field.Bool()))
+		case reflect.String:
+			url_values.Add(name, field.String())
+		case reflect.Slice:
+			if field.Len() == 0 {
+				// nil slice would otherwise be passed as null
+				url_values.Add(name, "[]")
+				continue
+			}
+			list, _ := json.Marshal(field.Interface())
+			url_values.Add(name, string(list))
+		}
+	}
+	return url_values
+}
+
+func isEmptyParam(field reflect.Value) bool {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return field.Float() == 0
+	case reflect.Bool:
+		return !field.Bool()
+	case reflect.String, reflect.Slice:
+		return field.Len() == 0
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeParams(t *testing.T) {
+	cpu := 0
+	ram := float32(2048)
+	cases := []struct {
+		name string
+		param interface{}
+		expected url.Values
+	}{
+		{
+			"zero values of fields without omitempty are sent",
+			&MachineCreateParam{ResGroupID: 7, Name: "vm"},
+			url.Values{
+				"cloudspaceId": {"7"}, "name": {"vm"}, "description": {""}, "vcpus": {"0"},
+				"memory": {"0"}, "imageId": {"0"}, "disksize": {"0"},
+			},
+		},
+		{
+			"omitempty fields are sent when set",
+			&MachineCreateParam{ResGroupID: 7, Name: "vm", Description: "web", Cpu: 2, Ram: 1024, ImageID: 3,
+			                    BootDisk: 10, DataDisks: []int{11, 12}, UserData: "users: []"},
+			url.Values{
+				"cloudspaceId": {"7"}, "name": {"vm"}, "description": {"web"}, "vcpus": {"2"},
+				"memory": {"1024"}, "imageId": {"3"}, "disksize": {"10"},
+				"datadisks": {"[11,12]"}, "userdata": {"users: []"},
+			},
+		},
+		{
+			"nil pointers are skipped and set ones sent even if zero",
+			&CloudspacesUpdateParam{ID: 5, Name: "rg", Cpu: &cpu, Ram: &ram},
+			url.Values{
+				"cloudspaceId": {"5"}, "name": {"rg"}, "maxCPUCapacity": {"0"}, "maxMemoryCapacity": {"2048.000000"},
+			},
+		},
+		{
+			"unset optional arguments of resource group",
+			&ResgroupCreateParam{TenantID: 1, Location: "loc", Name: "rg", Owner: "user"},
+			url.Values{"accountId": {"1"}, "location": {"loc"}, "name": {"rg"}, "access": {"user"}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := encodeParams(tc.param)
+			if !reflect.DeepEqual(*result, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, *result)
+			}
+		})
+	}
+}
+
+func testHTTPCallerServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("cannot parse request form: %s", err)
+		}
+		handler(w, r)
+	}))
+	return server
+}
+
+func TestHTTPCallerLegacy(t *testing.T) {
+	server := testHTTPCallerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case UserAuthenticateAPI:
+			if r.PostForm.Get("username") != "user" || r.PostForm.Get("password") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`"session-key"`))
+		case CloudspacesGetAPI:
+			if r.PostForm.Get("authkey") != "session-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{'id': 7, 'name': u'rg', 'status': 'DEPLOYED', 'acl': []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer server.Close()
+
+	caller := &HTTPCaller{ControllerURL: server.URL + "/"}
+	err := caller.Authenticate(context.Background(), "user", "wrong")
+	var status_err *APIStatusError
+	if !errors.As(err, &status_err) || status_err.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected status error 401 for wrong password, got %v", err)
+	}
+
+	err = caller.Authenticate(context.Background(), "user", "secret")
+	if err != nil {
+		t.Fatalf("cannot authenticate: %s", err)
+	}
+	if caller.SessionKey != "session-key" {
+		t.Fatalf("expected session key %q, got %q", "session-key", caller.SessionKey)
+	}
+
+	api := New(caller)
+	rg, err := api.Cloudspaces.Get(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("cannot get resource group: %s", err)
+	}
+	if rg.ID != 7 || rg.Name != "rg" {
+		t.Fatalf("unexpected resource group %+v", rg)
+	}
+}
+
+func TestHTTPCallerJWT(t *testing.T) {
+	server := testHTTPCallerServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "bearer token" || r.PostForm.Get("authkey") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case MachineCreateAPI:
+			w.Write([]byte("42"))
+		case MachineStopAPI:
+			w.Write([]byte("OK"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer server.Close()
+
+	api := New(&HTTPCaller{ControllerURL: server.URL, JWT: "token"})
+	vm_id, err := api.Machines.Create(context.Background(), &MachineCreateParam{ResGroupID: 7, Name: "vm"})
+	if err != nil {
+		t.Fatalf("cannot create VM: %s", err)
+	}
+	if vm_id != 42 {
+		t.Fatalf("expected VM ID 42, got %d", vm_id)
+	}
+	// plain text response is fine for API, which response is not used
+	err = api.Machines.Stop(context.Background(), vm_id)
+	if err != nil {
+		t.Fatalf("cannot stop VM: %s", err)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+
+	"context"
+	"fmt"
+	"net/url"
+
+)
+
+// CloudspacesService wraps /cloudapi/cloudspaces APIs. Cloudspaces are presented as resource
+// groups by the Terraform provider.
+type CloudspacesService struct {
+	client *Client
+}
+
+func (s *CloudspacesService) List(ctx context.Context, include_deleted bool) (CloudspacesListResp, error) {
+	url_values := &url.Values{}
+	url_values.Add("includedeleted", fmt.Sprintf("%t", include_deleted))
+	result := CloudspacesListResp{}
+	err := s.client.call(ctx, CloudspacesListAPI, url_values, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *CloudspacesService) Get(ctx context.Context, id int) (*CloudspacesGetResp, error) {
+	url_values := &url.Values{}
+	url_values.Add("cloudspaceId", fmt.Sprintf("%d", id))
+	result := &CloudspacesGetResp{}
+	err := s.client.call(ctx, CloudspacesGetAPI, url_values, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *CloudspacesService) Create(ctx context.Context, param *ResgroupCreateParam) (int, error) {
+	// cloudspaces/create API plainly returns ID of the new cloudspace on success
+	return s.client.callForID(ctx, ResgroupCreateAPI, encodeParams(param))
+}
+
+func (s *CloudspacesService) Update(ctx context.Context, param *CloudspacesUpdateParam) error {
+	return s.client.call(ctx, CloudspacesUpdateAPI, encodeParams(param), nil)
+}
+
+func (s *CloudspacesService) Delete(ctx context.Context, id int, permanently bool) error {
+	url_values := &url.Values{}
+	url_values.Add("cloudspaceId", fmt.Sprintf("%d", id))
+	url_values.Add("permanently", fmt.Sprintf("%t", permanently))
+	return s.client.call(ctx, CloudspacesDeleteAPI, url_values, nil)
+}
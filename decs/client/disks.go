@@ -0,0 +1,51 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+
+	"context"
+	"fmt"
+	"net/url"
+
+)
+
+// DisksService wraps /cloudapi/disks APIs. Attaching disks to VMs is done by MachinesService.
+type DisksService struct {
+	client *Client
+}
+
+func (s *DisksService) Create(ctx context.Context, param *DiskCreateParam) (int, error) {
+	// disks/create API plainly returns ID of the new disk on success
+	return s.client.callForID(ctx, DiskCreateAPI, encodeParams(param))
+}
+
+func (s *DisksService) Resize(ctx context.Context, id int, size int) error {
+	url_values := &url.Values{}
+	url_values.Add("diskId", fmt.Sprintf("%d", id))
+	url_values.Add("size", fmt.Sprintf("%d", size))
+	return s.client.call(ctx, DiskResizeAPI, url_values, nil)
+}
+
+func (s *DisksService) Delete(ctx context.Context, id int, permanently bool) error {
+	url_values := &url.Values{}
+	url_values.Add("diskId", fmt.Sprintf("%d", id))
+	url_values.Add("detach", "false")
+	url_values.Add("permanently", fmt.Sprintf("%t", permanently))
+	return s.client.call(ctx, DiskDeleteAPI, url_values, nil)
+}
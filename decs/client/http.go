@@ -0,0 +1,111 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+)
+
+const UserAuthenticateAPI = "/restmachine/cloudapi/users/authenticate"
+
+// HTTPCaller is a basic Caller that sends API calls to a single DECS controller. Calls are
+// authenticated with SessionKey in legacy mode or with JWT otherwise. HTTPCaller makes no retries
+// and does not renew the credential - callers that need this should provide their own Caller.
+type HTTPCaller struct {
+	ControllerURL string
+	HTTPClient *http.Client // http.DefaultClient is used if nil
+	SessionKey string
+	JWT string
+}
+
+// APIStatusError is returned by HTTPCaller when the controller replies with HTTP status other than 200.
+type APIStatusError struct {
+	APIName string
+	StatusCode int
+	Body string
+}
+
+func (e *APIStatusError) Error() string {
+	return fmt.Sprintf("API %q returned status code %d: %s", e.APIName, e.StatusCode, e.Body)
+}
+
+func (caller *HTTPCaller) Authenticate(ctx context.Context, user string, password string) error {
+	// Obtain session key for legacy user and keep it for subsequent API calls.
+	url_values := &url.Values{}
+	url_values.Add("username", user)
+	url_values.Add("password", password)
+	session_key, err := caller.send(ctx, "POST", UserAuthenticateAPI, url_values)
+	if err != nil {
+		return err
+	}
+	caller.SessionKey = strings.Trim(strings.TrimSpace(session_key), "\"'")
+	return nil
+}
+
+func (caller *HTTPCaller) CallAPI(ctx context.Context, method string, api_name string, url_values *url.Values) (string, error) {
+	// Caller's url_values are not modified, as session key is added to the copy of them.
+	req_values := url.Values{}
+	for key, value := range *url_values {
+		req_values[key] = value
+	}
+	if caller.SessionKey != "" {
+		req_values.Set("authkey", caller.SessionKey)
+	}
+	return caller.send(ctx, method, api_name, &req_values)
+}
+
+func (caller *HTTPCaller) send(ctx context.Context, method string, api_name string, url_values *url.Values) (string, error) {
+	// Send single API request and return response body if the controller replies with status 200.
+	params_str := url_values.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(caller.ControllerURL, "/") + api_name, strings.NewReader(params_str))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Content-Length", strconv.Itoa(len(params_str)))
+	if caller.JWT != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("bearer %s", caller.JWT))
+	}
+
+	http_client := caller.HTTPClient
+	if http_client == nil {
+		http_client = http.DefaultClient
+	}
+	resp, err := http_client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	resp_body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &APIStatusError{APIName: api_name, StatusCode: resp.StatusCode, Body: string(resp_body)}
+	}
+	return string(resp_body), nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+
+	"context"
+	"fmt"
+	"net/url"
+
+)
+
+// ImagesService wraps /cloudapi/images APIs.
+type ImagesService struct {
+	client *Client
+}
+
+func (s *ImagesService) List(ctx context.Context, tenant_id int, rgid int) (ImagesListResp, error) {
+	// List OS images available to the tenant and/or resource group. Zero IDs are not passed to the API.
+	url_values := &url.Values{}
+	if tenant_id != 0 {
+		url_values.Add("accountId", fmt.Sprintf("%d", tenant_id))
+	}
+	if rgid != 0 {
+		url_values.Add("cloudspaceId", fmt.Sprintf("%d", rgid))
+	}
+	result := ImagesListResp{}
+	err := s.client.call(ctx, ImagesListAPI, url_values, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
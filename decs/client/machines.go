@@ -0,0 +1,112 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+
+	"context"
+	"fmt"
+	"net/url"
+
+)
+
+// MachinesService wraps /cloudapi/machines APIs.
+type MachinesService struct {
+	client *Client
+}
+
+func (s *MachinesService) Create(ctx context.Context, param *MachineCreateParam) (int, error) {
+	// machines/create API plainly returns ID of the new VM on success
+	return s.client.callForID(ctx, MachineCreateAPI, encodeParams(param))
+}
+
+func (s *MachinesService) Get(ctx context.Context, id int) (*MachinesGetResp, error) {
+	url_values := &url.Values{}
+	url_values.Add("machineId", fmt.Sprintf("%d", id))
+	result := &MachinesGetResp{}
+	err := s.client.call(ctx, MachinesGetAPI, url_values, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *MachinesService) List(ctx context.Context, rgid int) (MachinesListResp, error) {
+	url_values := &url.Values{}
+	url_values.Add("cloudspaceId", fmt.Sprintf("%d", rgid))
+	result := MachinesListResp{}
+	err := s.client.call(ctx, MachinesListAPI, url_values, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *MachinesService) Delete(ctx context.Context, id int, permanently bool) error {
+	url_values := &url.Values{}
+	url_values.Add("machineId", fmt.Sprintf("%d", id))
+	url_values.Add("permanently", fmt.Sprintf("%t", permanently))
+	return s.client.call(ctx, MachineDeleteAPI, url_values, nil)
+}
+
+func (s *MachinesService) Resize(ctx context.Context, param *MachineResizeParam) error {
+	// both CPU count and RAM size are always passed, zero values included
+	return s.client.call(ctx, MachineResizeAPI, encodeParams(param), nil)
+}
+
+func (s *MachinesService) Update(ctx context.Context, id int, name string, description string) error {
+	// both name and description are always passed, so that description can be cleared
+	url_values := &url.Values{}
+	url_values.Add("machineId", fmt.Sprintf("%d", id))
+	url_values.Add("name", name)
+	url_values.Add("description", description)
+	return s.client.call(ctx, MachineUpdateAPI, url_values, nil)
+}
+
+func (s *MachinesService) Stop(ctx context.Context, id int) error {
+	url_values := &url.Values{}
+	url_values.Add("machineId", fmt.Sprintf("%d", id))
+	return s.client.call(ctx, MachineStopAPI, url_values, nil)
+}
+
+func (s *MachinesService) Start(ctx context.Context, id int) error {
+	url_values := &url.Values{}
+	url_values.Add("machineId", fmt.Sprintf("%d", id))
+	return s.client.call(ctx, MachineStartAPI, url_values, nil)
+}
+
+func (s *MachinesService) AttachDisk(ctx context.Context, vm_id int, disk_id int) error {
+	url_values := &url.Values{}
+	url_values.Add("machineId", fmt.Sprintf("%d", vm_id))
+	url_values.Add("diskId", fmt.Sprintf("%d", disk_id))
+	return s.client.call(ctx, DiskAttachAPI, url_values, nil)
+}
+
+func (s *MachinesService) DetachDisk(ctx context.Context, vm_id int, disk_id int) error {
+	url_values := &url.Values{}
+	url_values.Add("machineId", fmt.Sprintf("%d", vm_id))
+	url_values.Add("diskId", fmt.Sprintf("%d", disk_id))
+	return s.client.call(ctx, DiskDetachAPI, url_values, nil)
+}
+
+func (s *MachinesService) AttachExternalNetwork(ctx context.Context, vm_id int, net_id int) error {
+	url_values := &url.Values{}
+	url_values.Add("machineId", fmt.Sprintf("%d", vm_id))
+	url_values.Add("externalNetworkId", fmt.Sprintf("%d", net_id))
+	return s.client.call(ctx, AttachExternalNetworkAPI, url_values, nil)
+}
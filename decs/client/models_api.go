@@ -0,0 +1,368 @@
+/*
+Copyright (c) 2019 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+//
+// structures related to /cloudapi/cloudspaces/list API
+//
+type UserAclRecord struct {
+	Status string          `json:"status"`
+	CanBeDeleted bool      `json:"canBeDeleted"`
+	AccRights string       `json:"right"`
+	AccType string         `json:"type"`
+	UgroupID string        `json:"userGroupId"`
+}
+
+type AccountAclRecord struct {
+	Status string          `json:"status"`
+	AccRights string       `json:"right"`
+	IsExplicit bool        `json:"explicit"`
+	EntityID string        `json:"userGroupId"`
+	Guid string            `json:"guid"`
+	AccType string         `json:"type"`
+}
+
+type CloudspaceRecord struct {
+	Status string          `json:"status"`
+	UpdateTime uint64      `json:"updateTime"`
+	ExtNetIP string        `json:"externalnetworkip"`
+	Name string            `json:"name"`
+	Decsription string     `json:"descr"`
+	CreateTime uint64      `json:"creationTime"`
+	Acl []UserAclRecord    `json:"acl"`
+	Owner AccountAclRecord `json:"accountAcl"`
+	GridID int             `json:"gid"`
+	Location string        `json:"location"`
+	PublicIP string        `json:"publicipaddress"`
+	TenantName string      `json:"accountName"`
+	ID uint                `json:"id"`
+	TenantID int           `json:"accountId"`
+}
+
+const CloudspacesListAPI = "/restmachine/cloudapi/cloudspaces/list"
+type CloudspacesListResp []CloudspaceRecord
+
+//
+// structures related to /cloudapi/cloudspaces/create API call
+//
+const ResgroupCreateAPI= "/restmachine/cloudapi/cloudspaces/create"
+type ResgroupCreateParam struct {
+	TenantID int           `json:"accountId"`
+	Location string        `json:"location"`
+	Name string            `json:"name"`
+	Owner string           `json:"access"`
+	// quotas are not passed unless set, so that the controller applies its defaults
+	Cpu *int               `json:"maxCPUCapacity,omitempty"`
+	Ram *float32           `json:"maxMemoryCapacity,omitempty"`
+	Disk *int              `json:"maxVDiskCapacity,omitempty"`
+	NetTraffic *int        `json:"maxNetworkPeerTransfer,omitempty"`
+	ExtIPs *int            `json:"maxNumPublicIP,omitempty"`
+	ExtNetID int           `json:"externalnetworkid,omitempty"`
+	AllowedSizeIDs []int   `json:"allowedVMSizes,omitempty"`
+	IntNetRange string     `json:"privatenetwork,omitempty"`
+}
+
+//
+// structures related to /cloudapi/cloudspaces/update API call
+//
+const ResgroupUpdateAPI= "/restmachine/cloudapi/cloudspaces/update"
+
+//
+// structures related to /cloudapi/cloudspaces/get API call
+//
+type QuotaRecord struct {
+	Cpu int                `json:"CU_C"`
+	Ram float32            `json:"CU_M"` // NOTE: it is float32! Casting to int may be required when passing it to ResgroupConfig
+	Disk int               `json:"CU_D"`
+	NetTraffic int         `json:"CU_NP"`
+	ExtIPs int             `json:"CU_I"`
+}
+
+const CloudspacesGetAPI= "/restmachine/cloudapi/cloudspaces/get"
+type CloudspacesGetResp struct {
+	Status string          `json:"status"`
+	UpdateTime uint64      `json:"updateTime"`
+	ExtIP string           `json:"externalnetworkip"`
+	Description string     `json:"description"`
+	Quotas QuotaRecord     `json:"resourceLimits"`
+	ID uint                `json:"id"`
+	TenantID int           `json:"accountId"`
+	Name string            `json:"name"`
+	CreateTime uint64      `json:"creationTime"`
+	Acl []UserAclRecord    `json:"acl"`
+	Secret string          `json:"secret"`
+	GridID int             `json:"gid"`
+	Location string        `json:"location"`
+	PublicIP string        `json:"publicipaddress"`
+	Ignored map[string]interface{} `json:"-"`
+}
+
+// 
+// structures related to /cloudapi/cloudspaces/update API
+//
+const CloudspacesUpdateAPI = "/restmachine/cloudapi/cloudspaces/update"
+// NOTE: zero valued fields are not passed to the API, so only the quotas that are to be changed should be set
+type CloudspacesUpdateParam struct {
+	ID uint                `json:"cloudspaceId"`
+	Name string            `json:"name"`
+	// only the quotas being changed are set
+	Cpu *int               `json:"maxCPUCapacity,omitempty"`
+	Ram *float32           `json:"maxMemoryCapacity,omitempty"`
+	Disk *int              `json:"maxVDiskCapacity,omitempty"`
+	NetTraffic *int        `json:"maxNetworkPeerTransfer,omitempty"`
+	ExtIPs *int            `json:"maxNumPublicIP,omitempty"`
+}
+
+// 
+// structures related to /cloudapi/cloudspaces/delete API
+//
+const CloudspacesDeleteAPI = "/restmachine/cloudapi/cloudspaces/delete"
+
+//
+// structures related to /cloudapi/machines/create API
+//
+const MachineCreateAPI = "/restmachine/cloudapi/machines/create"
+type MachineCreateParam struct {
+	ResGroupID uint        `json:"cloudspaceId"`
+	Name string            `json:"name"`
+	Description string     `json:"description"`
+	Cpu int                `json:"vcpus"`
+	Ram int                `json:"memory"`
+	ImageID int            `json:"imageId"`
+	BootDisk int           `json:"disksize"`
+	DataDisks []int        `json:"datadisks,omitempty"`
+	UserData string        `json:"userdata,omitempty"`
+}
+
+// strucures related to cloudapi/machines/delete API
+const MachineDeleteAPI = "/restmachine/cloudapi/machines/delete"
+
+//
+// structures related to /cloudapi/machines/resize API
+//
+const MachineResizeAPI = "/restmachine/cloudapi/machines/resize"
+type MachineResizeParam struct {
+	MachineID int          `json:"machineId"`
+	Cpu int                `json:"vcpus"`
+	Ram int                `json:"memory"`
+}
+
+// structures related to /cloudapi/machines/update API
+const MachineUpdateAPI = "/restmachine/cloudapi/machines/update"
+
+// structures related to /cloudapi/machines/stop and /cloudapi/machines/start APIs
+const MachineStopAPI = "/restmachine/cloudapi/machines/stop"
+const MachineStartAPI = "/restmachine/cloudapi/machines/start"
+
+// 
+// structures related to /cloudapi/machines/list API
+//
+type NicRecord struct {
+	Status string          `json:"status"`       // did not see any other values but ""
+	MacAddress string      `json:"macAddress"`   // example "52:54:00:00:2d:2a"
+	ReferenceID string     `json:"referenceId"`  // did not see any other values but ""
+	DeviceName string      `json:"deviceName"`   // internal: "vm-13578-00a0", external: "vm-13578-6-ext
+	NicType string         `json:"type"`         // "bridge" for int net, "PUBLIC" for ext net
+	Params string          `json:"params"`       // for ext net "gateway:176.118.165.1 externalnetworkId:6"
+	NetworkID int          `json:"networkId"`    // did not see any other values but 0
+	Guid string            `json:"guid"`         // did not see any other values but ""
+	IPAddress string       `json:"ipAddress"`    // example "176.118.165.25/24"
+}
+
+type MachineRecord struct {
+	Status string          `json:"status"`
+	StackID int            `json:"stackId"`
+	UpdateTime uint64      `json:"updateTime"`
+	ReferenceID string     `json:"referenceId"`
+	Name string            `json:"name"`
+	NICs []NicRecord       `json:"nics"`
+	SizeID int             `json:"sizeId"`
+	DataDisks []uint       `json:"disks"`
+	CreateTime uint64      `json:"creationTime"`
+	ImageID int            `json:"imageId"`
+	BootDisk int           `json:"storage"`
+	Cpu int                `json:"vcpus"`
+	Ram int                `json:"memory"`
+	ID uint                `json:"id"`
+}
+
+const MachinesListAPI = "/restmachine/cloudapi/machines/list"
+type MachinesListResp []MachineRecord
+
+//
+// structures related to /cloudapi/machines/get
+//
+type DataDiskRecord struct {
+	Status string          `json:"status"`
+	SizeMax int            `json:"sizeMax"`
+	Label string           `json:"name"`
+	Description string     `json:"descr"`
+	Acl map[string]string  `json:"acl"`
+	DiskType string        `json:"type"`
+	ID uint                `json:"id"`
+}
+
+type GuestLoginRecord struct {
+	Guid string            `json:"guid"`
+	Login string           `json:"login"`
+	Password string        `json:"password"`
+}
+
+const MachinesGetAPI = "/restmachine/cloudapi/machines/get"
+type MachinesGetResp struct {
+	ResGroupID uint        `json:"cloudspaceid"` // note that "id" is not capitalized in "cloudspaceid"
+	Status string          `json:"status"`
+	UpdateTime uint64      `json:"updateTime"`
+	Hostname string        `json:"hostname"`
+	IsLocked bool          `json:"locked"`
+	Name string            `json:"name"`
+	CreateTime uint64      `json:"creationTime"`
+	SizeID uint            `json:"sizeid"`
+	Cpu int                `json:"vcpus"`
+	Ram int                `json:"memory"`
+	BootDisk int           `json:"storage"`
+	DataDisks []DataDiskRecord `json:"disks"`
+	NICs []NicRecord       `json:"interfaces"`
+	GuestLogins []GuestLoginRecord `json:"accounts"`
+	ImageName string       `json:"osImage"`
+	ImageID int            `json:"imageid"`
+	Description string     `json:"description"`
+	ID uint                `json:"id"`
+}
+
+//
+// structures related to /restmachine/cloudapi/images/list API
+//
+type ImageRecord struct {
+	Status string       `json:"status"`
+	Username string     `json:"username"`
+	Description string  `json:"description"`
+	TenantID uint       `json:"accountId"`
+	Size int            `json:"size"`
+	ImageType string    `json:"type"`
+	ID uint             `json:"id"`
+	Name string         `json:"name"`
+}
+
+const ImagesListAPI = "/restmachine/cloudapi/images/list"
+type ImagesListResp []ImageRecord
+
+//
+// structures related to /cloudapi/externalnetwork/list API
+//
+type ExtNetworkRecord struct {
+	IPRange string       `json:"name"`
+	ID uint              `json:"id"`
+} 
+
+const AccountExtNetworksListAPI = "/restmachine/cloudapi/externalnetwork/list"
+type AcountExtNetworksResp []ExtNetworkRecord
+
+//
+// Response of this call in current API version is just a list of attached network IDs
+const VmExtNetworksListAPI = "/restmachine/cloudapi/machines/listExternalNetworks"
+
+//
+// structures related to /cloudapi/accounts/list API
+//
+type TenantRecord struct {
+	ID int                 `json:"id"`
+	UpdateTime uint64      `json:"updateTime"`
+	CreateTime uint64      `json:"creationTime"`
+	Name string            `json:"name"`
+	Acl []UserAclRecord    `json:"acl"`
+}
+
+const TenantsListAPI = "/restmachine/cloudapi/accounts/list"
+type TenantsListResp []TenantRecord
+
+//
+// structures related to /cloudapi/portforwarding/list API
+//
+type PortforwardRecord struct {
+	ID int                 `json:"id"`
+	Proto string           `json:"protocol"`
+	IntPort string         `json:"localPort"`
+	ExtPort string         `json:"publicPort"`
+	ExtIP string           `json:"publicIp"`
+	IntIP string           `json:"localIp"`
+	VmID int               `json:"machineId"`
+	VmName string          `json:"machineName"`
+} 
+
+const PortforwardsListAPI = "/restmachine/cloudapi/portforwarding/list"
+type PortforwardsResp []PortforwardRecord
+
+const PortforwardingDeleteAPI = "/restmachine/cloudapi/portforwarding/delete"
+
+const PortforwardingCreateAPI = "/restmachine/cloudapi/portforwarding/create"
+type PortforwardingCreateParam struct {
+	ResGroupID int         `json:"cloudspaceId"`
+	VmID int               `json:"machineId"`
+	ExtIP string           `json:"publicIp"`
+	ExtPort int            `json:"publicPort"`
+	IntPort int            `json:"localPort"`
+	Proto string           `json:"protocol"`
+}
+
+//
+// structures related to /cloudapi/machines/attachExternalNetwork API
+//
+const AttachExternalNetworkAPI = "/restmachine/cloudapi/machines/attachExternalNetwork"
+
+//
+// structures related to /cloudapi/disks/create API
+//
+const DiskCreateAPI = "/restmachine/cloudapi/disks/create"
+type DiskCreateParam struct {
+	TenantID int           `json:"accountId"`
+	GridID int             `json:"gid"`
+	Name string            `json:"name"`
+	Description string     `json:"description"`
+	Size int               `json:"size"`
+	DiskType string        `json:"type"`
+}
+
+//
+// structures related to /cloudapi/machines/attachDisk API
+//
+const DiskAttachAPI = "/restmachine/cloudapi/machines/attachDisk"
+const DiskDetachAPI = "/restmachine/cloudapi/machines/detachDisk"
+
+//
+// structures related to /cloudapi/disks/resize and /cloudapi/disks/delete APIs
+//
+const DiskResizeAPI = "/restmachine/cloudapi/disks/resize"
+const DiskDeleteAPI = "/restmachine/cloudapi/disks/delete"
+
+
+//
+// structures related to /system/docgenerator/prepareCatalog API
+//
+const APICatalogAPI = "/restmachine/system/docgenerator/prepareCatalog"
+type APICatalogInfo struct {
+	Title string           `json:"title"`
+	Version string         `json:"version"`
+}
+
+// API catalog is a Swagger document describing all APIs the controller provides
+type APICatalogResp struct {
+	Info APICatalogInfo    `json:"info"`
+	BasePath string        `json:"basePath"`
+	Paths map[string]interface{} `json:"paths"`
+}
@@ -0,0 +1,54 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+
+	"context"
+	"fmt"
+	"net/url"
+
+)
+
+// PortforwardingService wraps /cloudapi/portforwarding APIs.
+type PortforwardingService struct {
+	client *Client
+}
+
+func (s *PortforwardingService) List(ctx context.Context, rgid int, vm_id int) (PortforwardsResp, error) {
+	url_values := &url.Values{}
+	url_values.Add("cloudspaceId", fmt.Sprintf("%d", rgid))
+	url_values.Add("machineId", fmt.Sprintf("%d", vm_id))
+	result := PortforwardsResp{}
+	err := s.client.call(ctx, PortforwardsListAPI, url_values, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *PortforwardingService) Create(ctx context.Context, param *PortforwardingCreateParam) error {
+	return s.client.call(ctx, PortforwardingCreateAPI, encodeParams(param), nil)
+}
+
+func (s *PortforwardingService) Delete(ctx context.Context, rgid int, id int) error {
+	url_values := &url.Values{}
+	url_values.Add("cloudspaceId", fmt.Sprintf("%d", rgid))
+	url_values.Add("id", fmt.Sprintf("%d", id))
+	return s.client.call(ctx, PortforwardingDeleteAPI, url_values, nil)
+}
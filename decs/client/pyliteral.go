@@ -0,0 +1,535 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+)
+
+// Parser for the subset of Python literal syntax that DECS controller uses in its API responses:
+// dictionaries, lists, tuples and sets, str/unicode/bytes strings (with u, b and r prefixes, single,
+// double and triple quotes, escape sequences), int/long/float numbers, True, False and None.
+// Object representations like <object at 0x...> are converted to strings.
+//
+// The parser emits equivalent JSON: tuples and sets become arrays, None becomes null and
+// non-string dictionary keys become strings.
+
+// nesting deeper than this is considered malformed input
+const pyMaxDepth = 512
+
+type pyParser struct {
+	src string
+	pos int
+	depth int
+	out bytes.Buffer
+}
+
+func PyLiteralToJSON(src string) (string, error) {
+	// Convert text of Python literal to JSON. Input, which is already valid JSON, is returned as is.
+	if json.Valid([]byte(src)) {
+		return src, nil
+	}
+	if strings.TrimSpace(src) == "" {
+		return "", nil
+	}
+
+	parser := &pyParser{src: src}
+	parser.skipSpace()
+	err := parser.parseValue()
+	if err != nil {
+		return "", err
+	}
+	parser.skipSpace()
+	if parser.pos < len(parser.src) {
+		return "", parser.errorf("unexpected %s after the end of value", parser.describeNext())
+	}
+	return parser.out.String(), nil
+}
+
+func (p *pyParser) errorf(format string, args ...interface{}) error {
+	// NOTE: the offending text is deliberately not quoted in the error, as API responses may contain secrets
+	return fmt.Errorf("malformed Python literal at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *pyParser) describeNext() string {
+	if p.pos >= len(p.src) {
+		return "end of input"
+	}
+	return fmt.Sprintf("character %q", p.src[p.pos])
+}
+
+func (p *pyParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\n', '\r', '\f', '\v':
+			p.pos += 1
+		default:
+			return
+		}
+	}
+}
+
+func (p *pyParser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *pyParser) expect(c byte) error {
+	p.skipSpace()
+	if p.peek() != c {
+		return p.errorf("expected %q, found %s", c, p.describeNext())
+	}
+	p.pos += 1
+	return nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *pyParser) parseValue() error {
+	p.skipSpace()
+	c := p.peek()
+	switch {
+	case c == '{':
+		return p.parseDict()
+	case c == '[':
+		return p.parseSequence('[', ']')
+	case c == '(':
+		return p.parseSequence('(', ')')
+	case c == '<':
+		return p.parseObjectRepr()
+	case c == '\'' || c == '"':
+		return p.parseStrings()
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case isIdentChar(c):
+		return p.parseName()
+	}
+	return p.errorf("unexpected %s", p.describeNext())
+}
+
+func (p *pyParser) enter() error {
+	p.depth += 1
+	if p.depth > pyMaxDepth {
+		return p.errorf("nesting is too deep")
+	}
+	return nil
+}
+
+func (p *pyParser) parseDict() error {
+	// Parse dictionary or set - both start with '{', but set items are not followed by ':'
+	if err := p.enter(); err != nil {
+		return err
+	}
+	defer func() { p.depth -= 1 }()
+
+	p.pos += 1 // skip '{'
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos += 1
+		p.out.WriteString("{}")
+		return nil
+	}
+
+	// parse the first item aside until we know if it is a key or a set element
+	first, err := p.parseDetached()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.peek() != ':' {
+		p.out.WriteByte('[')
+		p.out.Write(first)
+		return p.parseSequenceTail('}', ']')
+	}
+
+	p.out.WriteByte('{')
+	p.writeKey(first)
+	for {
+		if err := p.expect(':'); err != nil {
+			return err
+		}
+		p.out.WriteByte(':')
+		if err := p.parseValue(); err != nil {
+			return err
+		}
+
+		p.skipSpace()
+		had_comma := false
+		if p.peek() == ',' {
+			p.pos += 1
+			p.skipSpace()
+			had_comma = true
+		}
+		if p.peek() == '}' {
+			p.pos += 1
+			p.out.WriteByte('}')
+			return nil
+		}
+		if !had_comma {
+			return p.errorf("expected ',' or '}', found %s", p.describeNext())
+		}
+
+		p.out.WriteByte(',')
+		key, err := p.parseDetached()
+		if err != nil {
+			return err
+		}
+		p.writeKey(key)
+	}
+}
+
+func (p *pyParser) parseDetached() ([]byte, error) {
+	// Parse value and return its JSON text instead of leaving it in the output
+	start := p.out.Len()
+	err := p.parseValue()
+	value := append([]byte(nil), p.out.Bytes()[start:]...)
+	p.out.Truncate(start)
+	return value, err
+}
+
+func (p *pyParser) writeKey(key []byte) {
+	// JSON object keys must be strings, so keys of other types are converted to strings
+	if len(key) > 0 && key[0] == '"' {
+		p.out.Write(key)
+		return
+	}
+	p.writeString(string(key))
+}
+
+func (p *pyParser) parseSequence(open byte, close byte) error {
+	// Parse list or tuple into JSON array
+	if err := p.enter(); err != nil {
+		return err
+	}
+	defer func() { p.depth -= 1 }()
+
+	p.pos += 1 // skip opening bracket
+	p.skipSpace()
+	p.out.WriteByte('[')
+	if p.peek() == close {
+		p.pos += 1
+		p.out.WriteByte(']')
+		return nil
+	}
+	if err := p.parseValue(); err != nil {
+		return err
+	}
+	return p.parseSequenceTail(close, ']')
+}
+
+func (p *pyParser) parseSequenceTail(close byte, json_close byte) error {
+	// Parse the rest of sequence after its first element
+	for {
+		p.skipSpace()
+		if p.peek() == ',' {
+			p.pos += 1
+			p.skipSpace()
+			if p.peek() == close {
+				// trailing comma, e.g. in one element tuple (x,)
+				p.pos += 1
+				p.out.WriteByte(json_close)
+				return nil
+			}
+			p.out.WriteByte(',')
+			if err := p.parseValue(); err != nil {
+				return err
+			}
+			continue
+		}
+		if p.peek() == close {
+			p.pos += 1
+			p.out.WriteByte(json_close)
+			return nil
+		}
+		return p.errorf("expected ',' or %q, found %s", close, p.describeNext())
+	}
+}
+
+func (p *pyParser) parseObjectRepr() error {
+	// Representation of Python object that has no literal form, e.g. <Decimal 1.5> or
+	// <object at 0x7f...>, is converted to string with its content.
+	start := p.pos
+	level := 0
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '<':
+			level += 1
+		case '>':
+			level -= 1
+			if level == 0 {
+				p.pos += 1
+				p.writeString(p.src[start+1:p.pos-1])
+				return nil
+			}
+		}
+		p.pos += 1
+	}
+	p.pos = start
+	return p.errorf("unterminated object representation")
+}
+
+func (p *pyParser) parseName() error {
+	start := p.pos
+	for p.pos < len(p.src) && isIdentChar(p.src[p.pos]) {
+		p.pos += 1
+	}
+	name := p.src[start:p.pos]
+
+	// string prefix, e.g. u'text', b"data", r'raw'
+	if p.pos < len(p.src) && (p.src[p.pos] == '\'' || p.src[p.pos] == '"') && len(name) <= 2 &&
+	   strings.Trim(strings.ToLower(name), "ubr") == "" {
+		p.pos = start
+		return p.parseStrings()
+	}
+
+	switch name {
+	case "True", "true":
+		p.out.WriteString("true")
+	case "False", "false":
+		p.out.WriteString("false")
+	case "None", "null":
+		p.out.WriteString("null")
+	default:
+		p.pos = start
+		return p.errorf("unexpected name")
+	}
+	return nil
+}
+
+func (p *pyParser) parseNumber() error {
+	start := p.pos
+	if p.peek() == '-' || p.peek() == '+' {
+		p.pos += 1
+	}
+	negative := p.src[start] == '-'
+
+	// hexadecimal, octal and binary integers
+	if p.pos+1 < len(p.src) && p.src[p.pos] == '0' && strings.ContainsRune("xXoObB", rune(p.src[p.pos+1])) {
+		digits_start := p.pos
+		p.pos += 2
+		for p.pos < len(p.src) && isIdentChar(p.src[p.pos]) {
+			p.pos += 1
+		}
+		text := strings.TrimRight(p.src[digits_start:p.pos], "lL")
+		value, err := strconv.ParseInt(strings.ToLower(text), 0, 64)
+		if err != nil {
+			p.pos = start
+			return p.errorf("invalid integer")
+		}
+		if negative {
+			value = -value
+		}
+		p.out.WriteString(strconv.FormatInt(value, 10))
+		return nil
+	}
+
+	for p.pos < len(p.src) && strings.IndexByte("0123456789.eE_", p.src[p.pos]) >= 0 {
+		if (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') && p.pos+1 < len(p.src) &&
+		   (p.src[p.pos+1] == '-' || p.src[p.pos+1] == '+') {
+			p.pos += 1
+		}
+		p.pos += 1
+	}
+	text := strings.Replace(p.src[start:p.pos], "_", "", -1)
+	// Python 2 long integers have L suffix
+	if p.pos < len(p.src) && (p.src[p.pos] == 'L' || p.src[p.pos] == 'l') {
+		p.pos += 1
+	}
+
+	if strings.HasPrefix(text, "+") {
+		text = text[1:]
+	}
+	// normalize forms that are valid in Python, but not in JSON: 1., .5, 007
+	if _, err := strconv.ParseFloat(text, 64); err != nil {
+		p.pos = start
+		return p.errorf("invalid number")
+	}
+	if json.Valid([]byte(text)) {
+		p.out.WriteString(text)
+		return nil
+	}
+	if !strings.ContainsAny(text, ".eE") {
+		value, err := strconv.ParseInt(text, 10, 64)
+		if err == nil {
+			p.out.WriteString(strconv.FormatInt(value, 10))
+			return nil
+		}
+	}
+	value, _ := strconv.ParseFloat(text, 64)
+	p.out.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	return nil
+}
+
+func (p *pyParser) parseStrings() error {
+	// Parse string literal. Adjacent string literals are concatenated as Python does.
+	var text strings.Builder
+	for {
+		part, err := p.parseOneString()
+		if err != nil {
+			return err
+		}
+		text.WriteString(part)
+
+		save_pos := p.pos
+		p.skipSpace()
+		c := p.peek()
+		if c == '\'' || c == '"' {
+			continue
+		}
+		if isIdentChar(c) {
+			// may be prefixed string literal
+			end := p.pos
+			for end < len(p.src) && isIdentChar(p.src[end]) {
+				end += 1
+			}
+			if end < len(p.src) && (p.src[end] == '\'' || p.src[end] == '"') && end-p.pos <= 2 &&
+			   strings.Trim(strings.ToLower(p.src[p.pos:end]), "ubr") == "" {
+				continue
+			}
+		}
+		p.pos = save_pos
+		break
+	}
+	p.writeString(text.String())
+	return nil
+}
+
+func (p *pyParser) parseOneString() (string, error) {
+	start := p.pos
+	raw := false
+	for p.pos < len(p.src) && p.src[p.pos] != '\'' && p.src[p.pos] != '"' {
+		if p.src[p.pos] == 'r' || p.src[p.pos] == 'R' {
+			raw = true
+		}
+		p.pos += 1
+	}
+
+	quote := p.src[p.pos:p.pos+1]
+	if strings.HasPrefix(p.src[p.pos:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	p.pos += len(quote)
+
+	var text strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			p.pos = start
+			return "", p.errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], quote) {
+			p.pos += len(quote)
+			return text.String(), nil
+		}
+
+		c := p.src[p.pos]
+		if c == '\n' && len(quote) == 1 {
+			return "", p.errorf("line break in string")
+		}
+		if c != '\\' {
+			text.WriteByte(c)
+			p.pos += 1
+			continue
+		}
+
+		// escape sequence
+		if p.pos+1 >= len(p.src) {
+			p.pos = start
+			return "", p.errorf("unterminated string")
+		}
+		if raw {
+			// in raw strings backslash only prevents the next quote from terminating the string
+			text.WriteString(p.src[p.pos:p.pos+2])
+			p.pos += 2
+			continue
+		}
+		err := p.parseEscape(&text)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func (p *pyParser) parseEscape(text *strings.Builder) error {
+	esc := p.src[p.pos+1]
+	p.pos += 2
+	switch esc {
+	case '\n':
+		// line continuation
+	case '\\', '\'', '"':
+		text.WriteByte(esc)
+	case 'n':
+		text.WriteByte('\n')
+	case 'r':
+		text.WriteByte('\r')
+	case 't':
+		text.WriteByte('\t')
+	case 'b':
+		text.WriteByte('\b')
+	case 'f':
+		text.WriteByte('\f')
+	case 'v':
+		text.WriteByte('\v')
+	case 'a':
+		text.WriteByte('\a')
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		end := p.pos - 1
+		for end < len(p.src) && end < p.pos+2 && p.src[end] >= '0' && p.src[end] <= '7' {
+			end += 1
+		}
+		value, _ := strconv.ParseUint(p.src[p.pos-1:end], 8, 32)
+		text.WriteRune(rune(value))
+		p.pos = end
+	case 'x', 'u', 'U':
+		width := map[byte]int{'x': 2, 'u': 4, 'U': 8}[esc]
+		if p.pos+width > len(p.src) {
+			return p.errorf("truncated \\%c escape", esc)
+		}
+		value, err := strconv.ParseUint(p.src[p.pos:p.pos+width], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(value)) {
+			return p.errorf("invalid \\%c escape", esc)
+		}
+		text.WriteRune(rune(value))
+		p.pos += width
+	default:
+		// unknown escape sequences are kept as is
+		text.WriteByte('\\')
+		text.WriteByte(esc)
+	}
+	return nil
+}
+
+func (p *pyParser) writeString(text string) {
+	// Python 2 byte strings may contain invalid UTF-8, which JSON cannot represent - such bytes
+	// are replaced with U+FFFD by the encoder
+	encoder := json.NewEncoder(&p.out)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(text)
+	// Encode always appends newline, which is not needed here
+	p.out.Truncate(p.out.Len() - 1)
+}
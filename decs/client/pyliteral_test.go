@@ -0,0 +1,130 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+
+	"strings"
+	"testing"
+)
+
+func TestPyLiteralToJSON(t *testing.T) {
+	cases := []struct {
+		name string
+		src string
+		expected string
+	}{
+		// strings
+		{"unicode prefix", `u'text'`, `"text"`},
+		{"bytes prefix", `b'data'`, `"data"`},
+		{"raw prefix", `r'C:\new'`, `"C:\\new"`},
+		{"raw unicode prefix", `ur'\d+'`, `"\\d+"`},
+		{"double quotes", `"double"`, `"double"`},
+		{"escaped quote", `'it\'s'`, `"it's"`},
+		{"apostrophe in double quotes", `{'description': u"Bob's VM"}`, `{"description":"Bob's VM"}`},
+		{"escaped double quote", `'say \"hi\"'`, `"say \"hi\""`},
+		{"control escapes", `'a\nb\tc\\d'`, `"a\nb\tc\\d"`},
+		{"numeric escapes", `'\x41\u0042\101\U00000043'`, `"ABAC"`},
+		{"unknown escape", `'\q'`, `"\\q"`},
+		{"angle brackets", `u'<b>&'`, `"<b>&"`},
+		{"triple quotes", "'''multi\nline'''", `"multi\nline"`},
+		{"adjacent strings", `'ab' u'cd'`, `"abcd"`},
+		{"line continuation", "'ab\\\ncd'", `"abcd"`},
+		// numbers
+		{"integer", `42`, `42`},
+		{"negative", `-7`, `-7`},
+		{"plus sign", `+3`, `3`},
+		{"long", `12345678901L`, `12345678901`},
+		{"long in dict", `{'id': 1L}`, `{"id":1}`},
+		{"hex", `0x1F`, `31`},
+		{"negative hex", `-0x10`, `-16`},
+		{"leading zeros", `007`, `7`},
+		{"float", `1.5`, `1.5`},
+		{"trailing dot", `1.`, `1`},
+		{"leading dot", `.5`, `0.5`},
+		{"exponent", `1e3`, `1e3`},
+		// constants
+		{"true", `True`, `true`},
+		{"false", `False`, `false`},
+		{"none", `None`, `null`},
+		// containers
+		{"list", `[1, 'a', None]`, `[1,"a",null]`},
+		{"trailing comma", `[1, 2,]`, `[1,2]`},
+		{"tuple", `(1, 2)`, `[1,2]`},
+		{"one element tuple", `(1,)`, `[1]`},
+		{"empty tuple", `()`, `[]`},
+		{"set", `{1, 2}`, `[1,2]`},
+		{"empty dict", `{}`, `{}`},
+		{"non-string keys", `{u'a': 1, 2: None, (1, 2): True}`, `{"a":1,"2":null,"[1,2]":true}`},
+		{"nested", `{'disks': [{'id': 1L, 'size': 10}], 'ok': True, 'tags': ('a',), 'ids': {3}}`,
+		 `{"disks":[{"id":1,"size":10}],"ok":true,"tags":["a"],"ids":[3]}`},
+		{"object representation", `{'price': <Decimal 1.5>}`, `{"price":"Decimal 1.5"}`},
+		// input that is already JSON is passed as is
+		{"JSON object", `{"a": [1, 2], "b": null}`, `{"a": [1, 2], "b": null}`},
+		{"JSON string", `"text"`, `"text"`},
+		{"blank", "  \n", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := PyLiteralToJSON(tc.src)
+			if err != nil {
+				t.Fatalf("Failed to convert %q: %s", tc.src, err)
+			}
+			if result != tc.expected {
+				t.Errorf("Converted %q to %q, expected %q", tc.src, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestPyLiteralToJSONMalformed(t *testing.T) {
+	cases := []struct {
+		name string
+		src string
+		expect_error string
+	}{
+		{"plain text", `OK`, "unexpected name"},
+		{"unterminated dict", `{'a': 1`, "expected ',' or '}', found end of input"},
+		{"missing colon", `{'a': 1, 'b' 2}`, "expected ':'"},
+		{"missing comma", `[1 2]`, "expected ',' or ']'"},
+		{"unterminated string", `'abc`, "unterminated string"},
+		{"line break in string", "'ab\ncd'", "line break in string"},
+		{"truncated escape", `'\x4'`, "invalid \\x escape"},
+		{"bad number", `1.2.3`, "invalid number"},
+		{"trailing data", `1 2`, "unexpected character '2' after the end of value"},
+		{"unterminated object representation", `<object`, "unterminated object representation"},
+		{"too deep", strings.Repeat("[", pyMaxDepth + 1), "nesting is too deep"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := PyLiteralToJSON(tc.src)
+			if err == nil {
+				t.Fatalf("Malformed input %q converted to %q", tc.src, result)
+			}
+			if !strings.Contains(err.Error(), tc.expect_error) {
+				t.Errorf("Error %q does not include %q", err, tc.expect_error)
+			}
+		})
+	}
+
+	// offending text may contain secrets, so it must not appear in the error
+	_, err := PyLiteralToJSON(`{'password': 'top-secret' oops}`)
+	if err == nil || strings.Contains(err.Error(), "top-secret") {
+		t.Errorf("Error for malformed input includes its content: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+
+	"context"
+	"net/url"
+
+)
+
+// SystemService wraps /system APIs, which describe the controller itself.
+type SystemService struct {
+	client *Client
+}
+
+func (s *SystemService) Catalog(ctx context.Context) (*APICatalogResp, error) {
+	// Return catalog of APIs provided by the controller
+	result := &APICatalogResp{}
+	err := s.client.call(ctx, APICatalogAPI, &url.Values{}, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -19,21 +19,27 @@ package decs
 
 import (
 
+	"context"
 	"bytes"
 	"fmt"
+	"errors"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
-	// "time"
+	"sync"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	// "github.com/hashicorp/terraform/terraform"
 
+	"github.com/terraform-provider-decs/decs/client"
+
 )
 
 // enumerated constants that define authentication modes 
@@ -45,7 +51,7 @@ const (
 )
 
 type ControllerCfg struct {
-	controller_url   string  // always required
+	endpoints        *controllerEndpoints // URLs of DECS controller nodes, at least one is always required
 	auth_mode_code   int     // always required
 	auth_mode_txt    string  // always required, it is a text representation of auth mode
 	legacy_user      string  // required for legacy mode
@@ -57,128 +63,237 @@ type ControllerCfg struct {
 	oauth2_url       string  // always required
 	decs_username    string  // assigned to either legacy_user (legacy mode) or Oauth2 user (oauth2 mode) upon successful verification
 	cc_client        *http.Client // assigned when all initial check successfully passed
+	jwt_validity     int     // validity period in seconds to request for JWT in oauth2 mode
+	jwt_expiry       time.Time // expiration time of the current JWT as read from its "exp" claim, zero if JWT has no such claim
+	jwt_lifetime     time.Duration // lifetime of the current JWT counting from the moment it was obtained
+	auth_mutex       sync.Mutex // serializes session setup, JWT refresh and legacy re-login between concurrently running API calls
+	session_ready    bool    // set once credentials are obtained and validated on the first API call
+	max_retries      int     // how many times failed API call may be repeated if the failure looks transient
+	max_backoff      int     // upper limit in seconds for the delay between repeated API calls
+	jwt_file         string  // file to (re-)read JWT from in jwt mode, alternative to static jwt
+	credential_process string // external command that prints JWT (jwt mode) or app ID and secret (oauth2 mode)
+	throttle         *apiThrottle // limits concurrency and rate of API requests to the controller
+	api              *client.Client // typed access to DECS cloudapi on top of decsAPICall
+	recorder         *apiRecorder // records or replays controller traffic, nil if recording is off
+	cache            *apiCache // short lived cache of list API responses, nil if caching is disabled
+	stop_ctx         context.Context // done when Terraform asks the provider to stop, parent of all operation contexts
+	caps             *apiCapabilities // capabilities of the controller, detected on the first need
+	caps_mutex       sync.Mutex
 }
 
+// initial delay before repeating failed API call, it doubles on each subsequent retry
+var retryBaseDelay = time.Second
+
+// validity period in seconds to request for JWT in oauth2 mode when jwt_validity is not set, and
+// the shortest period that can be requested
+const defaultJWTValidity = 3600
+const minJWTValidity = 60
+
+// JWT in oauth2 mode is refreshed when the remaining part of its lifetime falls below this fraction
+// of the full lifetime, but never earlier than jwtRefreshMarginMax before the actual expiration
+const jwtRefreshFraction = 10
+const jwtRefreshMarginMax = time.Minute * 5
+
 func ControllerConfigure(d *schema.ResourceData) (*ControllerCfg, error) {
 	// This function first will check that all required provider parameters for the 
 	// selected authenticator mode are set correctly and initialize ControllerCfg structure
 	// based on the provided parameters.
 	//
-	// Next, it will check for validity of supplied credentials by initiating connection to the specified 
-	// DECS controller URL and, if succeeded, completes ControllerCfg structure with the rest of computed 
-	// parameters (e.g. JWT, session ID and Oauth2 user name).
+	// Validity of supplied credentials is not checked here. It will be checked by establishSession() 
+	// on the first call to decsAPICall(), which connects to the specified DECS controller URL and, 
+	// if succeeded, completes ControllerCfg structure with the rest of computed parameters (e.g. JWT, 
+	// session ID and Oauth2 user name).
 	//
 	// The structure created by this function should be used with subsequent calls to decsAPICall() method, 
 	// which is a DECS authentication mode aware wrapper around standard HTTP requests.
 
+	// arguments, which are not set explicitly, may be taken from the profile in DECS config file
+	args, err := newProviderArgs(d)
+	if err != nil {
+		return nil, err
+	}
+
 	ret_config := &ControllerCfg{
-		controller_url:  d.Get("controller_url").(string),
+		stop_ctx:        context.Background(),
 		auth_mode_code:  MODE_UNDEF,
-		legacy_user:     d.Get("user").(string),
-		legacy_password: d.Get("password").(string),
+		legacy_user:     args.getString("user"),
+		legacy_password: args.getString("password"),
 		legacy_sid:      "",
-		jwt:             d.Get("jwt").(string),
-		app_id:          d.Get("app_id").(string),
-		app_secret:      d.Get("app_secret").(string),
-		oauth2_url:      d.Get("oauth2_url").(string),
+		jwt:             args.getString("jwt"),
+		app_id:          args.getString("app_id"),
+		app_secret:      args.getString("app_secret"),
+		oauth2_url:      args.getString("oauth2_url"),
 		decs_username:   "",
+		jwt_validity:    args.getInt("jwt_validity"),
+		max_retries:     args.getInt("max_retries"),
+		max_backoff:     args.getInt("max_backoff"),
+		jwt_file:        args.getString("jwt_file"),
+		credential_process: args.getString("credential_process"),
 	}
 
-	if ret_config.controller_url == "" {
+	// controller_url, if set, is the first node followed by the nodes listed in controller_urls
+	var controller_urls []string
+	for _, node_url := range append([]string{args.getString("controller_url")}, args.getStringList("controller_urls", "DECS_CONTROLLER_URLS")...) {
+		node_url = strings.TrimRight(strings.TrimSpace(node_url), "/")
+		if node_url == "" {
+			continue
+		}
+		duplicate := false
+		for _, known_url := range controller_urls {
+			duplicate = duplicate || known_url == node_url
+		}
+		if !duplicate {
+			controller_urls = append(controller_urls, node_url)
+		}
+	}
+	if len(controller_urls) == 0 {
 		return nil, fmt.Errorf("Empty DECS cloud controller URL provided.")
 	}
+	ret_config.endpoints = newControllerEndpoints(controller_urls)
+
+	// jwt_validity from the profile is not checked by the schema
+	if ret_config.jwt_validity == 0 {
+		ret_config.jwt_validity = defaultJWTValidity
+	}
+	if ret_config.jwt_validity < minJWTValidity {
+		return nil, fmt.Errorf("JWT validity period %d is too short, jwt_validity must be at least %d seconds.", 
+		                       ret_config.jwt_validity, minJWTValidity)
+	}
 
 	// this should have already been done by StateFunc defined in Schema, but we want to be sure
-	ret_config.auth_mode_txt = strings.ToLower(d.Get("authenticator").(string))
+	ret_config.auth_mode_txt = strings.ToLower(args.getString("authenticator"))
 
 	switch ret_config.auth_mode_txt {
 	case "jwt":
-		if ret_config.jwt == "" {
-			return nil, fmt.Errorf("Authenticator mode 'jwt' specified but no JWT provided.")
+		if ret_config.jwt == "" && !ret_config.hasJWTSource() {
+			return nil, fmt.Errorf("Authenticator mode 'jwt' specified but no JWT, JWT file or credential process provided.")
 		}
 		ret_config.auth_mode_code = MODE_JWT
 	case "oauth2":
 		if ret_config.oauth2_url == "" {
 			return nil, fmt.Errorf("Authenticator mode 'oauth2' specified but no OAuth2 URL provided.")
 		}
-		if ret_config.app_id == "" {
+		// with credential process application ID and secret will be obtained on the first API call
+		if ret_config.app_id == "" && ret_config.credential_process == "" {
 			return nil, fmt.Errorf("Authenticator mode 'oauth2' specified but no Application ID provided.")
 		}
-		if ret_config.app_secret == "" {
+		if ret_config.app_secret == "" && ret_config.credential_process == "" {
 			return nil, fmt.Errorf("Authenticator mode 'oauth2' specified but no Secret ID provided.")
 		}
 		ret_config.auth_mode_code = MODE_OAUTH2
 	case "legacy":
 		//
-		ret_config.legacy_user = d.Get("user").(string)
 		if ret_config.legacy_user == "" {
 			return nil, fmt.Errorf("Authenticator mode 'legacy' specified but no user provided.")
 		}
-		ret_config.legacy_password = d.Get("password").(string)
 		if ret_config.legacy_password == "" {
 			return nil, fmt.Errorf("Authenticator mode 'legacy' specified but no password provided.")
 		}
 		ret_config.auth_mode_code = MODE_LEGACY
+	case "":
+		return nil, fmt.Errorf("No authenticator mode provided.")
 	default:
 		return nil, fmt.Errorf("Unknown authenticator mode %q provided.", ret_config.auth_mode_txt)
 	}
 
-	ret_config.cc_client = &http.Client{
-		Timeout: Timeout180s, // time.Second * 30,
+	// the same TLS settings are used for connections to both DECS controller and Oauth2 provider
+	tls_config, err := makeTLSConfig(args)
+	if err != nil {
+		return nil, err
+	}
+	ret_config.cc_client = makeHTTPClient(tls_config)
+	ret_config.throttle = newAPIThrottle(args.getInt("max_concurrent_requests"), args.d.Get("requests_per_second").(float64))
+	ret_config.api = client.New(ret_config)
+	ret_config.cache = newAPICache(args.getBool("disable_cache"))
+	ret_config.recorder, err = newAPIRecorder(args.getString("recording_mode"), args.getString("recording_file"))
+	if err != nil {
+		return nil, err
+	}
+
+	if ret_config.auth_mode_code == MODE_JWT && !ret_config.hasJWTSource() {
+		// static JWT cannot be refreshed by the provider, but we still read its expiration time
+		// in order to report meaningful error once the controller rejects it
+		err := ret_config.setJWT(ret_config.jwt)
+		if err != nil {
+			log.Printf("ControllerConfigure: JWT expiration time is unknown: %s", err)
+		}
 	}
 
-	switch ret_config.auth_mode_code {
+	// All checks passed successfully. Credentials corresponding to the selected authenticator mode
+	// will be obtained and validated by establishSession() on the first API call, so that no network
+	// I/O occurs when Terraform only validates configuration.
+	return ret_config, nil
+}
+
+func (config *ControllerCfg) establishSession(ctx context.Context) error {
+	// Obtain and validate credentials corresponding to the selected authenticator mode by connecting
+	// to the DECS controller or Oauth2 provider. Once succeeded, the session is kept for the rest of 
+	// the provider run. This method must be called with auth_mutex locked.
+	if config.session_ready {
+		return nil
+	}
+
+	if config.recorder.replaying() {
+		// no connection to the controller is made in replay mode, user name is taken from the recording
+		username, err := config.recorder.replaySession()
+		if err != nil {
+			return err
+		}
+		config.decs_username = username
+		config.session_ready = true
+		return nil
+	}
+
+	switch config.auth_mode_code {
 	case MODE_LEGACY:
-		ok, err := ret_config.validateLegacyUser() 
+		ok, err := config.validateLegacyUser(ctx)
 		if !ok {
-			return nil, err
+			return err
 		}
-		ret_config.decs_username = ret_config.legacy_user
+		config.decs_username = config.legacy_user
 	case MODE_JWT:
-		//
-		ok, err := ret_config.validateJWT("")
+		// JWT from jwt_file or credential process is read at this point
+		_, err := config.obtainJWT(ctx)
+		if err != nil {
+			return err
+		}
+		ok, err := config.validateJWT(ctx, "")
 		if !ok {
-			return nil, err
+			return err
 		}
 	case MODE_OAUTH2:
-		// on success getOAuth2JWT will set config.jwt to the obtained JWT, so there is no 
-		// need to set it once again here
-		_, err := ret_config.getOAuth2JWT()
-		if err != nil {
-			return nil, err
-		}
-		// we are not verifying the JWT when parsing because actual verification is done on the 
-		// OVC controller side. Here we do parsing solely to extract Oauth2 user name (claim "user")
-		// and JWT issuer name (claim "iss")
-		parser := jwt.Parser{}
-		token, _, err := parser.ParseUnverified(ret_config.jwt, jwt.MapClaims{})
+		// on success obtainJWT will set config.jwt to the obtained JWT and also extract Oauth2 
+		// user name from it, so there is no need to set these once again here
+		_, err := config.obtainJWT(ctx)
 		if err != nil {
-			return nil, err
-		}
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			var tbuf bytes.Buffer
-			tbuf.WriteString(claims["username"].(string))
-			tbuf.WriteString("@")
-			tbuf.WriteString(claims["iss"].(string))
-			ret_config.decs_username =  tbuf.String() 
-		} else {
-			return nil, fmt.Errorf("Failed to extract user and iss fields from JWT token in oauth2 mode.")
+			return err
 		}
 	default:
-		// FYI, this should never happen due to all above checks, but we want to be fool proof
-		return nil, fmt.Errorf("Unknown authenticator mode code %d provided.", ret_config.auth_mode_code)
+		// FYI, this should never happen due to all checks in ControllerConfigure, but we want to be fool proof
+		return fmt.Errorf("Unknown authenticator mode code %d provided.", config.auth_mode_code)
 	}
 
-	// All checks passed successfully, credentials corresponding to the selected authenticator mode
-	// obtained and validated.
-	return ret_config, nil
+	log.Printf("establishSession: authenticated to DECS controller %q in %q mode", config.endpoints.current(), config.auth_mode_txt)
+	config.session_ready = true
+	if config.recorder.recording() {
+		config.recorder.recordSession(config.auth_mode_txt, config.decs_username)
+	}
+	return nil
 }
 
-func (config *ControllerCfg) getDecsUsername() (string) {
-	return config.decs_username
+func (config *ControllerCfg) getDecsUsername(ctx context.Context) (string, error) {
+	// User name is known only after the session is established
+	config.auth_mutex.Lock()
+	defer config.auth_mutex.Unlock()
+
+	err := config.establishSession(ctx)
+	if err != nil {
+		return "", err
+	}
+	return config.decs_username, nil
 }
 
-func (config *ControllerCfg) getOAuth2JWT() (string, error) {
+func (config *ControllerCfg) getOAuth2JWT(ctx context.Context) (string, error) {
 	// 	Obtain JWT from the Oauth2 provider using application ID and application secret provided in config.
 	if config.auth_mode_code == MODE_UNDEF {
 		return "", fmt.Errorf("getOAuth2JWT method called for undefined authorization mode.")
@@ -192,10 +307,10 @@ func (config *ControllerCfg) getOAuth2JWT() (string, error) {
 	params.Add("client_id", config.app_id)
 	params.Add("client_secret", config.app_secret)
 	params.Add("response_type", "id_token")
-	params.Add("validity", "3600")
+	params.Add("validity", fmt.Sprintf("%d", config.jwt_validity))
 	params_str := params.Encode()
 
-	req, err := http.NewRequest("POST", config.oauth2_url + "/v1/oauth/access_token", strings.NewReader(params_str))
+	req, err := http.NewRequestWithContext(ctx, "POST", config.oauth2_url + "/v1/oauth/access_token", strings.NewReader(params_str))
 	if err != nil {
 		return "", err
 	}
@@ -206,14 +321,14 @@ func (config *ControllerCfg) getOAuth2JWT() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		// fmt.Println("response Status:", resp.Status)
 		// fmt.Println("response Headers:", resp.Header)
 		// fmt.Println("response Headers:", req.URL)
 		return "", fmt.Errorf("getOauth2JWT: unexpected status code %d when obtaining JWT from %q for APP_ID %q, request Body %q", 
-		resp.StatusCode, req.URL, config.app_id, params_str)
+		resp.StatusCode, req.URL, config.app_id, redactValues(params))
 	}
-	defer resp.Body.Close()
 
 	responseData, err := ioutil.ReadAll(resp.Body)
     if err != nil {
@@ -221,12 +336,175 @@ func (config *ControllerCfg) getOAuth2JWT() (string, error) {
     }
  
 	// validation successful - store JWT in the corresponding field of the ControllerCfg structure
-	config.jwt = strings.TrimSpace(string(responseData))
+	err = config.setJWT(strings.TrimSpace(string(responseData)))
+	if err != nil {
+		return "", err
+	}
 
 	return config.jwt, nil
 }
 
-func (config *ControllerCfg) validateJWT(jwt string) (bool, error) {
+func (config *ControllerCfg) setJWT(token_str string) error {
+	// Store JWT in the config and extract from it expiration time (claim "exp") and, for oauth2 mode,
+	// the name of the Oauth2 user. In jwt mode the JWT is stored even if it cannot be parsed.
+	//
+	// We are not verifying the JWT when parsing because actual verification is done on the 
+	// OVC controller side. Here we do parsing solely to extract Oauth2 user name (claim "username"),
+	// JWT issuer name (claim "iss") and expiration time.
+	config.jwt = token_str
+	config.jwt_expiry = time.Time{}
+	config.jwt_lifetime = 0
+
+	parser := jwt.Parser{}
+	token, _, err := parser.ParseUnverified(token_str, jwt.MapClaims{})
+	if err != nil {
+		return fmt.Errorf("Failed to parse JWT: %s", err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return fmt.Errorf("Failed to extract claims from JWT.")
+	}
+
+	if exp, ok := claims["exp"].(float64); ok {
+		config.jwt_expiry = time.Unix(int64(exp), 0)
+		config.jwt_lifetime = time.Until(config.jwt_expiry)
+		log.Printf("setJWT: JWT expires at %s", config.jwt_expiry.Format(time.RFC3339))
+	}
+
+	if config.auth_mode_code == MODE_OAUTH2 {
+		username, ok_user := claims["username"].(string)
+		issuer, ok_iss := claims["iss"].(string)
+		if !ok_user || !ok_iss {
+			return fmt.Errorf("Failed to extract user and iss fields from JWT token in oauth2 mode.")
+		}
+		var tbuf bytes.Buffer
+		tbuf.WriteString(username)
+		tbuf.WriteString("@")
+		tbuf.WriteString(issuer)
+		config.decs_username =  tbuf.String() 
+	}
+
+	return nil
+}
+
+func (config *ControllerCfg) jwtExpiresSoon() bool {
+	// Check if JWT is about to expire and should be refreshed before it is used in the next API call.
+	// JWT without "exp" claim is considered to never expire.
+	if config.jwt_expiry.IsZero() {
+		return false
+	}
+	margin := config.jwt_lifetime / jwtRefreshFraction
+	if margin > jwtRefreshMarginMax {
+		margin = jwtRefreshMarginMax
+	}
+	return time.Until(config.jwt_expiry) < margin
+}
+
+func (config *ControllerCfg) jwtExpiredAt() (time.Time, bool) {
+	// Return expiration time of the current JWT if it has already expired.
+	config.auth_mutex.Lock()
+	defer config.auth_mutex.Unlock()
+
+	if config.jwt_expiry.IsZero() || time.Now().Before(config.jwt_expiry) {
+		return time.Time{}, false
+	}
+	return config.jwt_expiry, true
+}
+
+func (config *ControllerCfg) getCurrentJWT(ctx context.Context) (string, error) {
+	// Return JWT to authenticate the next API call. In oauth2 mode, as well as in jwt mode with
+	// jwt_file or credential_process, the JWT is transparently refreshed ahead of its expiration. 
+	// This method must be called with auth_mutex locked.
+	if config.jwtExpiresSoon() {
+		if config.auth_mode_code == MODE_OAUTH2 || config.hasJWTSource() {
+			log.Printf("getCurrentJWT: JWT expires at %s, obtaining new one", config.jwt_expiry.Format(time.RFC3339))
+			return config.obtainJWT(ctx)
+		}
+		if time.Now().After(config.jwt_expiry) {
+			return "", fmt.Errorf("JWT provided in 'jwt' authentication mode expired at %s, please supply a new one.", 
+			                      config.jwt_expiry.Format(time.RFC3339))
+		}
+	}
+
+	return config.jwt, nil
+}
+
+func (config *ControllerCfg) renewJWT(ctx context.Context, stale_jwt string) (string, error) {
+	// Obtain new JWT after the controller rejected stale_jwt. If concurrent API call has already 
+	// replaced stale_jwt with a new one, this new JWT is returned without obtaining it again.
+	// Returns empty string without error if there is no way to get JWT other than stale_jwt.
+	config.auth_mutex.Lock()
+	defer config.auth_mutex.Unlock()
+
+	if config.jwt != stale_jwt {
+		return config.jwt, nil
+	}
+	log.Printf("renewJWT: JWT was rejected by DECS controller, obtaining new one")
+	new_jwt, err := config.obtainJWT(ctx)
+	if err != nil || new_jwt == stale_jwt {
+		return "", err
+	}
+	return new_jwt, nil
+}
+
+func (config *ControllerCfg) getCredential(ctx context.Context) (string, error) {
+	// Return credential to authenticate the next API call: session key in legacy mode or 
+	// JWT in oauth2 and jwt modes. Session is established on the first call.
+	config.auth_mutex.Lock()
+	defer config.auth_mutex.Unlock()
+
+	err := config.establishSession(ctx)
+	if err != nil {
+		return "", err
+	}
+	if config.auth_mode_code == MODE_LEGACY {
+		return config.legacy_sid, nil
+	}
+	return config.getCurrentJWT(ctx)
+}
+
+func (config *ControllerCfg) renewCredential(ctx context.Context, stale_credential string) (string, error) {
+	// Obtain new credential after the controller rejected stale_credential. Returns empty string
+	// without error if the credential cannot be renewed in the current authorization mode.
+	switch config.auth_mode_code {
+	case MODE_LEGACY:
+		return config.renewSessionKey(ctx, stale_credential)
+	case MODE_OAUTH2, MODE_JWT:
+		return config.renewJWT(ctx, stale_credential)
+	}
+	return "", nil
+}
+
+func (config *ControllerCfg) renewSessionKey(ctx context.Context, stale_sid string) (string, error) {
+	// Log in once again with legacy user credentials after the controller rejected session key stale_sid.
+	// API calls, which run concurrently and were rejected with the same session key, will wait here
+	// and then reuse the session key obtained by the first of them, so that only one login occurs.
+	config.auth_mutex.Lock()
+	defer config.auth_mutex.Unlock()
+
+	if config.legacy_sid != stale_sid {
+		return config.legacy_sid, nil
+	}
+	log.Printf("renewSessionKey: session key was rejected by DECS controller, logging in as legacy user %q once again", 
+	           config.legacy_user)
+	ok, err := config.validateLegacyUser(ctx)
+	if !ok {
+		return "", err
+	}
+	return config.legacy_sid, nil
+}
+
+func isAuthFailure(auth_mode_code int, status_code int) bool {
+	// Check if HTTP status code returned by DECS controller means that the credential used for
+	// the API call is no longer valid. Expired session in legacy mode may also be reported
+	// with non-standard status code 419.
+	if status_code == http.StatusUnauthorized {
+		return true
+	}
+	return auth_mode_code == MODE_LEGACY && status_code == 419
+}
+
+func (config *ControllerCfg) validateJWT(ctx context.Context, jwt string) (bool, error) {
 	/*
 	Validate JWT against DECS controller. JWT can be supplied as argument to this method. If empty string supplied as
 	argument, JWT will be taken from config attribute. 
@@ -244,29 +522,29 @@ func (config *ControllerCfg) validateJWT(jwt string) (bool, error) {
 		return false, fmt.Errorf("validateJWT method called, but no OAuth2 URL provided.")
 	}
 
-	req, err := http.NewRequest("POST", config.controller_url + "/restmachine/cloudapi/accounts/list", nil)
-	if err != nil {
-		return false, err
-	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("bearer %s", jwt))
-	// req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	// req.Header.Set("Content-Length", strconv.Itoa(0))
-	
-	resp, err := config.cc_client.Do(req)	
+	resp, err := config.doWithFailover(ctx, func(node_url string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", node_url + "/restmachine/cloudapi/accounts/list", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("bearer %s", jwt))
+		// req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		// req.Header.Set("Content-Length", strconv.Itoa(0))
+		return req, nil
+	})
 	if err != nil {
 		return false, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return false, fmt.Errorf("validateJWT: unexpected status code %d when validating JWT against %q.", 
-		resp.StatusCode, req.URL)
+		resp.StatusCode, resp.Request.URL)
 	}
-	defer resp.Body.Close()
 
 	return true, nil
 }
 
-func (config *ControllerCfg) validateLegacyUser() (bool, error) {
+func (config *ControllerCfg) validateLegacyUser(ctx context.Context) (bool, error) {
 	/*
 	Validate legacy user by obtaining a session key, which will be used for authenticating subsequent API calls
     to DECS controller.
@@ -285,27 +563,27 @@ func (config *ControllerCfg) validateLegacyUser() (bool, error) {
 	params.Add("password", config.legacy_password)
 	params_str := params.Encode()
 
-	req, err := http.NewRequest("POST", config.controller_url + "/restmachine/cloudapi/users/authenticate", strings.NewReader(params_str))
-	if err != nil {
-		return false, err
-	}
-
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Content-Length", strconv.Itoa(len(params_str)))
-
-	resp, err := config.cc_client.Do(req)	
+	resp, err := config.doWithFailover(ctx, func(node_url string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", node_url + "/restmachine/cloudapi/users/authenticate", strings.NewReader(params_str))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Content-Length", strconv.Itoa(len(params_str)))
+		return req, nil
+	})
 	if err != nil {
 		return false, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return false, fmt.Errorf("validateLegacyUser: unexpected status code %d when validating legacy user %q against %q.", 
-		resp.StatusCode, config.legacy_user, config.controller_url)
+		resp.StatusCode, config.legacy_user, config.endpoints.current())
 	}
-	defer resp.Body.Close()
 
 	responseData, err := ioutil.ReadAll(resp.Body)
     if err != nil {
-        log.Fatal(err)
+        return false, err
     }
  
 	// validation successful - keep session ID for future use
@@ -314,7 +592,31 @@ func (config *ControllerCfg) validateLegacyUser() (bool, error) {
 	return true, nil
 }
 
-func (config *ControllerCfg) decsAPICall(method string, api_name string, url_values *url.Values) (json_resp string, err error) {
+func (config *ControllerCfg) operationContext(d *schema.ResourceData, timeout_key string) (context.Context, context.CancelFunc) {
+	// Create context for a single CRUD operation of a resource or data source. The context is done
+	// when the operation timeout expires or when Terraform asks the provider to stop (e.g. on Ctrl-C),
+	// which aborts API calls in progress and waiting for status transitions.
+	// The context carries correlation ID that marks trace lines of the operation's API calls.
+	ctx, op_id := withOperationID(config.stop_ctx)
+	log.Printf("[DEBUG] operationContext: op=%s %s operation on ID %q with timeout %s", op_id, timeout_key, d.Id(), d.Timeout(timeout_key))
+	return context.WithTimeout(ctx, d.Timeout(timeout_key))
+}
+
+func (config *ControllerCfg) planContext() (context.Context, context.CancelFunc) {
+	// Create context for checks made by the provider at plan time, e.g. in CustomizeDiff functions,
+	// where resource operation timeouts are not available.
+	ctx, op_id := withOperationID(config.stop_ctx)
+	log.Printf("[DEBUG] planContext: op=%s plan time check", op_id)
+	return context.WithTimeout(ctx, Timeout60s)
+}
+
+func (config *ControllerCfg) CallAPI(ctx context.Context, method string, api_name string, url_values *url.Values) (string, error) {
+	// ControllerCfg implements client.Caller interface, so that typed DECS cloudapi client
+	// makes its calls through decsAPICall
+	return config.decsAPICall(ctx, method, api_name, url_values)
+}
+
+func (config *ControllerCfg) decsAPICall(ctx context.Context, method string, api_name string, url_values *url.Values) (api_resp string, err error) {
 	// This is a convenience wrapper around standard HTTP request methods that is aware of the 
 	// authorization mode for which the provider was initialized and compiles request accordingly.
 
@@ -341,47 +643,244 @@ func (config *ControllerCfg) decsAPICall(method string, api_name string, url_val
 		return "", fmt.Errorf("decsAPICall method called for unknown authorization mode.")
 	}
 
-	if config.auth_mode_code == MODE_LEGACY {
-		url_values.Add("authkey", config.legacy_sid)
+	if config.cache.cacheable(api_name) {
+		return config.cache.get(ctx, method, api_name, url_values, func() (string, error) {
+			return config.callController(ctx, method, api_name, url_values)
+		})
+	}
+	api_resp, err = config.callController(ctx, method, api_name, url_values)
+	if !isReadOnlyAPI(api_name) {
+		// even failed call may have modified something on the controller
+		config.cache.invalidate(api_name)
 	}
-	params_str := url_values.Encode()
+	return api_resp, err
+}
+
+func (config *ControllerCfg) callController(ctx context.Context, method string, api_name string, url_values *url.Values) (string, error) {
+	// Make API call to the controller, repeating it if the failure looks transient.
 
-	req, err := http.NewRequest(method, config.controller_url + api_name, strings.NewReader(params_str))
+	// Failed API call is repeated with exponentially growing delay if the failure looks transient
+	// and repeating the call is safe. The total time spent on retries is bounded by the deadline
+	// of the call context, which comes from the timeout of the resource operation.
+	//
+	// If the controller node fails and another healthy node is available, subsequent calls go to
+	// that node. The failed call is repeated there at once, without counting it as a retry, if it
+	// is read-only or has not reached the failed node. Other calls do not fail over, as the failed
+	// node may have carried them out anyway.
+	var resp_body []byte
+	var status_code int
+	var err error
+	attempt := 0
+	for {
+		node_url := config.endpoints.current()
+		resp_body, status_code, err = config.exchangeAPIRequest(ctx, method, api_name, url_values)
+		can_switch := isReadOnlyAPI(api_name) || isRequestNotSent(err)
+		switched := ctx.Err() == nil && can_switch && isNodeFailure(status_code, err) && config.failover(ctx, node_url)
+		if ctx.Err() != nil || !isRetryable(api_name, status_code, err) {
+			break
+		}
+		if switched {
+			log.Printf("decsAPICall: API %q failed on DECS controller node %q, repeating on %q", 
+			           api_name, node_url, config.endpoints.current())
+			continue
+		}
+		attempt += 1
+		if attempt > config.max_retries {
+			break
+		}
+		delay := config.retryDelay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			log.Printf("decsAPICall: no time left to retry API %q", api_name)
+			break
+		}
+		if err != nil {
+			log.Printf("decsAPICall: API %q failed with %s, retry %d of %d in %s", 
+			           api_name, err, attempt, config.max_retries, delay)
+		} else {
+			log.Printf("decsAPICall: API %q returned status code %d, retry %d of %d in %s", 
+			           api_name, status_code, attempt, config.max_retries, delay)
+		}
+		if !config.recorder.replaying() {
+			err = sleepContext(ctx, delay)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
 	if err != nil {
 		return "", err
 	}
+
+    if status_code == http.StatusOK {
+		// response is returned as is - some APIs reply with plain text, e.g. "OK", and it is up to the caller
+		// to convert the response to JSON with Jo2JSON if it needs the response at all
+		return string(resp_body), nil
+	} 
+
+	return "", newDecsAPIError(api_name, status_code, resp_body, redactValues(*url_values))
+}
+
+func (config *ControllerCfg) exchangeAPIRequest(ctx context.Context, method string, api_name string, url_values *url.Values) ([]byte, int, error) {
+	// Send API request to the controller or, in replay mode, take the response from the recording.
+	started := time.Now()
+	if config.recorder.replaying() {
+		resp_body, status_code, err := config.recorder.replayCall(method, api_name, url_values)
+		traceAPICall(ctx, "replay:", method, api_name, url_values, status_code, resp_body, err, time.Since(started))
+		return resp_body, status_code, err
+	}
+	node_url := config.endpoints.current()
+	resp_body, status_code, err := config.sendAuthenticatedRequest(ctx, method, api_name, url_values)
+	traceAPICall(ctx, node_url, method, api_name, url_values, status_code, resp_body, err, time.Since(started))
+	if err == nil && config.recorder.recording() {
+		config.recorder.recordCall(method, api_name, url_values, status_code, resp_body)
+	}
+	return resp_body, status_code, err
+}
+
+func (config *ControllerCfg) sendAuthenticatedRequest(ctx context.Context, method string, api_name string, url_values *url.Values) ([]byte, int, error) {
+	// Send API request with the current credential. If the controller rejects the credential, renew it
+	// and replay the request once.
+	credential, err := config.getCredential(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp_body, status_code, err := config.sendAPIRequest(ctx, method, api_name, url_values, credential)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if isAuthFailure(config.auth_mode_code, status_code) {
+		// session key may have been expired or revoked by the controller, JWT may have been revoked 
+		// or expired earlier than we expected - get new credential and replay the request once
+		credential, err = config.renewCredential(ctx, credential)
+		if err != nil {
+			return nil, 0, err
+		}
+		if credential != "" {
+			return config.sendAPIRequest(ctx, method, api_name, url_values, credential)
+		} 
+		if config.auth_mode_code == MODE_JWT {
+			if expiry, expired := config.jwtExpiredAt(); expired {
+				return nil, 0, fmt.Errorf("decsAPICall: JWT provided in 'jwt' authentication mode expired at %s, please supply a new one.", 
+				                          expiry.Format(time.RFC3339))
+			}
+		}
+	}
+
+	return resp_body, status_code, nil
+}
+
+func isReadOnlyAPI(api_name string) bool {
+	// Check if API call only reads data from the controller, so that it is safe to repeat it
+	// regardless of whether the previous attempt has reached the controller or not.
+	if api_name == client.APICatalogAPI {
+		// API catalog is only prepared for the caller, nothing is changed on the controller
+		return true
+	}
+	api_verb := api_name[strings.LastIndex(api_name, "/")+1:]
+	return strings.HasPrefix(api_verb, "get") || strings.HasPrefix(api_verb, "list")
+}
+
+func isRetryable(api_name string, status_code int, err error) bool {
+	// Check if failed API call should be repeated.
+	if err != nil {
+		// Only transport errors, which are always reported by HTTP client as *url.Error, may be transient.
+		// Failure to establish connection means that the request has not reached the controller,
+		// so it is safe to repeat any API call. Other transport errors leave us uncertain about
+		// the outcome, so we only repeat calls that do not modify anything.
+		var url_err *url.Error
+		if !errors.As(err, &url_err) {
+			return false
+		}
+		if isRequestNotSent(err) {
+			return true
+		}
+		return isReadOnlyAPI(api_name)
+	}
+
+	switch status_code {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		// controller declined to process the request, e.g. during maintenance window 
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		// request might have reached the controller behind the gateway
+		return isReadOnlyAPI(api_name)
+	}
+
+	return false
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	// Sleep for the specified delay unless the context is done earlier.
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (config *ControllerCfg) retryDelay(attempt int) time.Duration {
+	// Calculate delay before the specified retry attempt (counting from 1) using exponential backoff
+	// capped at max_backoff with random jitter, so that parallel operations do not retry in sync.
+	max_backoff := time.Duration(config.max_backoff) * time.Second
+	delay := retryBaseDelay << uint(attempt - 1)
+	if delay > max_backoff || delay <= 0 {
+		delay = max_backoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2) + 1))
+}
+
+func (config *ControllerCfg) sendAPIRequest(ctx context.Context, method string, api_name string, url_values *url.Values, credential string) ([]byte, int, error) {
+	// Send single API request to DECS controller and return response body and HTTP status code.
+	// Credential (session key or JWT) is added to the request according to the authorization 
+	// mode. Caller's url_values are not modified, so that the same request can be safely repeated.
+	req_values := url.Values{}
+	for key, value := range *url_values {
+		req_values[key] = value
+	}
+	if config.auth_mode_code == MODE_LEGACY {
+		req_values.Set("authkey", credential)
+	}
+	params_str := req_values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, config.endpoints.current() + api_name, strings.NewReader(params_str))
+	if err != nil {
+		return nil, 0, err
+	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Content-Length", strconv.Itoa(len(params_str)))
 
 	if config.auth_mode_code == MODE_OAUTH2 || config.auth_mode_code == MODE_JWT {
-		req.Header.Set("Authorization", fmt.Sprintf("bearer %s", config.jwt))
+		req.Header.Set("Authorization", fmt.Sprintf("bearer %s", credential))
 	} 
 	
+	waited, err := config.throttle.acquire(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer config.throttle.release()
+	if waited > throttleWaitLogThreshold {
+		log.Printf("[DEBUG] sendAPIRequest: API %q waited %s for its turn due to request limits", api_name, waited)
+	}
+
+	started := time.Now()
 	resp, err := config.cc_client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
-    if resp.StatusCode == http.StatusOK {
-		tmp_body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return "", err
-		} 
-		json_resp := Jo2JSON(string(tmp_body))
-		log.Printf("decsAPICall:\n %s", json_resp)
-		return json_resp, nil
-	} else {
-		return "", fmt.Errorf("decsAPICall: unexpected status code %d when calling API %q with request Body %q", 
-		resp.StatusCode, req.URL, params_str)
+	resp_body, err := ioutil.ReadAll(resp.Body)
+	if elapsed := time.Since(started); elapsed > slowCallLogThreshold {
+		log.Printf("[DEBUG] sendAPIRequest: API %q took %s to complete", api_name, elapsed)
 	}
-	
-	/*
-	if resp.StatusCode == StatusServiceUnavailable {
-        return nil, fmt.Errorf("decsAPICall method called for incompatible authorization mode %q.", config.auth_mode_txt)
+	if err != nil {
+		return nil, resp.StatusCode, err
 	}
-	*/
 
-	return "", err
+	return resp_body, resp.StatusCode, nil
 }
-
@@ -0,0 +1,306 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+
+	"github.com/terraform-provider-decs/decs/client"
+)
+
+func testControllerConfig(t *testing.T, raw map[string]interface{}) *ControllerCfg {
+	// Configure controller from provider arguments the way providerConfigure does
+	d := schema.TestResourceDataRaw(t, Provider().Schema, raw)
+	config, err := ControllerConfigure(d)
+	if err != nil {
+		t.Fatalf("ControllerConfigure failed: %s", err)
+	}
+	return config
+}
+
+func testControllerConfigOAuth2(t *testing.T, fc *fakeController) *ControllerCfg {
+	return testControllerConfig(t, map[string]interface{}{
+		"authenticator":  "oauth2",
+		"controller_url": fc.URL(),
+		"oauth2_url":     fc.URL(),
+		"app_id":         fakeAppID,
+		"app_secret":     fakeAppSecret,
+		"max_retries":    0,
+		"disable_cache":  true,
+	})
+}
+
+func testControllerConfigLegacy(t *testing.T, fc *fakeController) *ControllerCfg {
+	return testControllerConfig(t, map[string]interface{}{
+		"authenticator":  "legacy",
+		"controller_url": fc.URL(),
+		"user":           fakeLegacyUser,
+		"password":       fakeLegacyPassword,
+		"max_retries":    0,
+		"disable_cache":  true,
+	})
+}
+
+func testControllerConfigRetries(t *testing.T, fc *fakeController, max_retries int) *ControllerCfg {
+	return testControllerConfig(t, map[string]interface{}{
+		"authenticator":  "legacy",
+		"controller_url": fc.URL(),
+		"user":           fakeLegacyUser,
+		"password":       fakeLegacyPassword,
+		"max_retries":    max_retries,
+		"disable_cache":  true,
+	})
+}
+
+func testSetRetryBaseDelay(delay time.Duration) func() {
+	// Shorten delay between retries and return function that restores it
+	saved_delay := retryBaseDelay
+	retryBaseDelay = delay
+	return func() { retryBaseDelay = saved_delay }
+}
+
+func testListImages(t *testing.T, config *ControllerCfg) {
+	_, err := config.decsAPICall(context.Background(), "POST", client.ImagesListAPI, &url.Values{})
+	if err != nil {
+		t.Fatalf("API call failed: %s", err)
+	}
+}
+
+func TestControllerJWTRefreshBeforeExpiry(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := testControllerConfigOAuth2(t, fc)
+
+	testListImages(t, config)
+	if count := fc.authCount("access_token"); count != 1 {
+		t.Fatalf("JWT was obtained %d times on the first API call, expected once.", count)
+	}
+
+	// JWT obtained for an hour is now about to expire, as if most of the hour has passed
+	config.auth_mutex.Lock()
+	config.jwt_expiry = time.Now().Add(time.Second * 10)
+	config.auth_mutex.Unlock()
+
+	testListImages(t, config)
+	if count := fc.authCount("access_token"); count != 2 {
+		t.Errorf("JWT was obtained %d times, expected it to be refreshed once before expiry.", count)
+	}
+	if count := fc.callCount(client.ImagesListAPI); count != 2 {
+		t.Errorf("API was called %d times, expected no call to be rejected and repeated.", count)
+	}
+}
+
+func TestControllerJWTRetryOnUnauthorized(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := testControllerConfigOAuth2(t, fc)
+
+	testListImages(t, config)
+
+	// controller forgets the JWT well before its expiration time
+	fc.revokeCredentials()
+	testListImages(t, config)
+	if count := fc.authCount("access_token"); count != 2 {
+		t.Errorf("JWT was obtained %d times, expected once again after it was rejected.", count)
+	}
+	if count := fc.callCount(client.ImagesListAPI); count != 3 {
+		t.Errorf("API was called %d times, expected rejected call to be repeated once.", count)
+	}
+
+	// the request is repeated only once, after that the failure is reported
+	fc.mutex.Lock()
+	fc.deny_tokens = true
+	fc.mutex.Unlock()
+	_, err := config.decsAPICall(context.Background(), "POST", client.ImagesListAPI, &url.Values{})
+	if apiErrorKind(err) != API_ERR_UNAUTHORIZED {
+		t.Errorf("Expected unauthorized error from API call with JWT that cannot be renewed, got %v.", err)
+	}
+	if count := fc.callCount(client.ImagesListAPI); count != 5 {
+		t.Errorf("API was called %d times, expected rejected call to be repeated once.", count)
+	}
+}
+
+func TestControllerLegacyReloginOnce(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := testControllerConfigLegacy(t, fc)
+	login_api := "/restmachine/cloudapi/users/authenticate"
+
+	testListImages(t, config)
+	if count := fc.callCount(login_api); count != 1 {
+		t.Fatalf("Provider logged in %d times on the first API call, expected once.", count)
+	}
+
+	// all API calls running in parallel are rejected with the expired session key at once
+	fc.revokeCredentials()
+	const parallel_calls = 20
+	errs := make(chan error, parallel_calls)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel_calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := config.decsAPICall(context.Background(), "POST", client.ImagesListAPI, &url.Values{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("API call failed after session expiry: %s", err)
+		}
+	}
+
+	if count := fc.callCount(login_api); count != 2 {
+		t.Errorf("Provider logged in %d times, expected a single login after session expiry.", count)
+	}
+}
+
+func TestControllerRetryTransientStatus(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	defer testSetRetryBaseDelay(time.Millisecond * 10)()
+	config := testControllerConfigRetries(t, fc, 3)
+
+	fc.failCalls(client.ImagesListAPI, http.StatusServiceUnavailable, 2)
+	testListImages(t, config)
+	if count := fc.callCount(client.ImagesListAPI); count != 3 {
+		t.Errorf("API was called %d times, expected two failed calls to be repeated.", count)
+	}
+
+	// retries are limited by max_retries
+	fc.failCalls(client.ImagesListAPI, http.StatusServiceUnavailable, 10)
+	_, err := config.decsAPICall(context.Background(), "POST", client.ImagesListAPI, &url.Values{})
+	if apiErrorKind(err) != API_ERR_TRANSIENT {
+		t.Errorf("Expected transient error after retries are exhausted, got %v.", err)
+	}
+	if count := fc.callCount(client.ImagesListAPI) - 3; count != 4 {
+		t.Errorf("API was called %d times, expected the call and 3 retries.", count)
+	}
+}
+
+func TestControllerNoRetry(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	defer testSetRetryBaseDelay(time.Millisecond * 10)()
+	config := testControllerConfigRetries(t, fc, 3)
+	testListImages(t, config)
+
+	cases := []struct {
+		name string
+		api_name string
+		status int
+	}{
+		{"client error", client.ImagesListAPI, http.StatusBadRequest},
+		{"conflict", client.ImagesListAPI, http.StatusConflict},
+		// request might have been executed by the controller behind the gateway
+		{"bad gateway on write", client.DiskDeleteAPI, http.StatusBadGateway},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls_before := fc.callCount(tc.api_name)
+			fc.failCalls(tc.api_name, tc.status, 1)
+			_, err := config.decsAPICall(context.Background(), "POST", tc.api_name, &url.Values{"diskId": {"1"}})
+			if err == nil {
+				t.Fatalf("API call succeeded despite injected failure.")
+			}
+			if count := fc.callCount(tc.api_name) - calls_before; count != 1 {
+				t.Errorf("API was called %d times, expected no retries.", count)
+			}
+		})
+	}
+}
+
+func TestControllerRetryDeadline(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	defer testSetRetryBaseDelay(time.Millisecond * 100)()
+	config := testControllerConfigRetries(t, fc, 10)
+	testListImages(t, config)
+
+	// retries stop once the next one would not fit into the operation timeout
+	fc.failCalls(client.ImagesListAPI, http.StatusServiceUnavailable, 1000)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond * 300)
+	defer cancel()
+	started := time.Now()
+	_, err := config.decsAPICall(ctx, "POST", client.ImagesListAPI, &url.Values{})
+	if apiErrorKind(err) != API_ERR_TRANSIENT {
+		t.Errorf("Expected transient error when no time is left for retries, got %v.", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Millisecond * 300 {
+		t.Errorf("API call took %s, expected retries to stop before the deadline.", elapsed)
+	}
+	if count := fc.callCount(client.ImagesListAPI) - 1; count < 2 || count > 4 {
+		t.Errorf("API was called %d times, expected retries to be bounded by the deadline.", count)
+	}
+}
+
+func TestIsRetryableTransportError(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead_url := dead.URL
+	dead.Close()
+	_, dial_err := http.Post(dead_url + client.DiskDeleteAPI, "application/x-www-form-urlencoded", nil)
+	if dial_err == nil {
+		t.Fatalf("Request to closed server succeeded.")
+	}
+
+	// connection refused means the request has not reached the controller, so any call may be repeated
+	if !isRetryable(client.DiskDeleteAPI, 0, dial_err) {
+		t.Errorf("Call that failed to connect is not retryable: %s", dial_err)
+	}
+	// errors other than transport ones are never retried
+	if isRetryable(client.ImagesListAPI, 0, context.Canceled) {
+		t.Errorf("Cancelled call is retryable.")
+	}
+}
+
+func TestControllerPlainTextResponse(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := testControllerConfigLegacy(t, fc)
+	rgid := fc.addCloudspace("tf-acc-rg")
+	vm_id := fc.addMachine(rgid, "tf-acc-vm", 1, 1024)
+
+	// response that is not a Python literal does not fail the call if the caller discards it
+	fc.replyPlainText(client.MachineUpdateAPI, "OK")
+	err := config.api.Machines.Update(context.Background(), vm_id, "tf-acc-vm-renamed", "")
+	if err != nil {
+		t.Errorf("API call with plain text response failed: %s", err)
+	}
+	if fc.findMachine("tf-acc-vm-renamed") == nil {
+		t.Errorf("API call with plain text response was not made.")
+	}
+
+	// caller that needs the result gets decoding error
+	fc.replyPlainText(client.MachinesGetAPI, "OK")
+	_, err = config.api.Machines.Get(context.Background(), vm_id)
+	if err == nil || !strings.Contains(err.Error(), "Cannot decode response") {
+		t.Errorf("Expected decoding error for plain text response, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+)
+
+// TLS protocol versions that can be set as the minimum acceptable version by tls_min_version argument
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// minimum TLS version to accept when tls_min_version is not set
+const defaultTLSMinVersion = "1.2"
+
+func tlsVersionNames() []string {
+	return []string{"1.0", "1.1", "1.2", "1.3"}
+}
+
+func readPEMArg(arg_name string, arg_value string) ([]byte, error) {
+	// Arguments holding certificates and keys may contain either PEM encoded data as is or a path
+	// to the file with such data.
+	if strings.Contains(arg_value, "-----BEGIN") {
+		return []byte(arg_value), nil
+	}
+	data, err := ioutil.ReadFile(arg_value)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s file %q: %s", arg_name, arg_value, err)
+	}
+	return data, nil
+}
+
+func makeTLSConfig(args *providerArgs) (*tls.Config, error) {
+	// Build TLS configuration for connections to DECS controller and Oauth2 provider based on
+	// provider arguments.
+	tls_config := &tls.Config{
+		InsecureSkipVerify: args.getBool("allow_unverified_ssl"),
+	}
+	if tls_config.InsecureSkipVerify {
+		log.Printf("makeTLSConfig: server certificate verification is disabled by allow_unverified_ssl")
+	}
+
+	min_version := args.getString("tls_min_version")
+	if min_version == "" {
+		min_version = defaultTLSMinVersion
+	}
+	version, ok := tlsVersions[min_version]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported TLS version %q specified in tls_min_version.", min_version)
+	}
+	tls_config.MinVersion = version
+
+	ca_file := args.getString("ca_file")
+	ca_pem := args.getString("ca_pem")
+	if ca_file != "" || ca_pem != "" {
+		// custom CA certificates are added to those trusted by the system
+		ca_pool, err := x509.SystemCertPool()
+		if err != nil || ca_pool == nil {
+			log.Printf("makeTLSConfig: cannot load system CA certificates, only custom CA will be trusted")
+			ca_pool = x509.NewCertPool()
+		}
+		if ca_file != "" {
+			ca_data, err := ioutil.ReadFile(ca_file)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to read CA certificate file %q: %s", ca_file, err)
+			}
+			if !ca_pool.AppendCertsFromPEM(ca_data) {
+				return nil, fmt.Errorf("No valid PEM encoded certificates found in CA certificate file %q.", ca_file)
+			}
+		}
+		if ca_pem != "" && !ca_pool.AppendCertsFromPEM([]byte(ca_pem)) {
+			return nil, fmt.Errorf("No valid PEM encoded certificates found in ca_pem argument.")
+		}
+		tls_config.RootCAs = ca_pool
+	}
+
+	client_cert := args.getString("client_cert")
+	client_key := args.getString("client_key")
+	if client_cert != "" || client_key != "" {
+		if client_cert == "" || client_key == "" {
+			return nil, fmt.Errorf("Both client_cert and client_key must be specified to use client certificate authentication.")
+		}
+		cert_data, err := readPEMArg("client certificate", client_cert)
+		if err != nil {
+			return nil, err
+		}
+		key_data, err := readPEMArg("client key", client_key)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := tls.X509KeyPair(cert_data, key_data)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate and key: %s", err)
+		}
+		tls_config.Certificates = []tls.Certificate{cert}
+	}
+
+	return tls_config, nil
+}
+
+func makeHTTPClient(tls_config *tls.Config) *http.Client {
+	// HTTP client for all requests to DECS controller and Oauth2 provider. There is no overall
+	// client timeout - each request is bounded by the context of the operation it belongs to.
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tls_config,
+		},
+	}
+}
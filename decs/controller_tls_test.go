@@ -0,0 +1,186 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/terraform-provider-decs/decs/client"
+)
+
+func startFakeTLSController(fc *fakeController, tls_config *tls.Config) {
+	// Serve the fake controller over TLS with the test certificate of httptest package, which
+	// is signed by its own CA unknown to the system
+	fc.server.Close()
+	fc.server = httptest.NewUnstartedServer(http.HandlerFunc(fc.serveHTTP))
+	fc.server.TLS = tls_config
+	fc.server.StartTLS()
+}
+
+func fakeServerCAPEM(fc *fakeController) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: fc.server.Certificate().Raw}))
+}
+
+func testGenerateCert(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parent_key *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	// Generate certificate with new key, self-signed if parent is nil, and return it along with PEM encoded data
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	if parent == nil {
+		parent, parent_key = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parent_key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %s", err)
+	}
+	key_der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %s", err)
+	}
+	return cert, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	       string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key_der}))
+}
+
+func testClientCertificate(t *testing.T) (*x509.CertPool, string, string) {
+	// Generate CA and client certificate signed by it, return pool with the CA for the server
+	// and PEM encoded client certificate and key
+	not_before := time.Now().Add(-time.Hour)
+	ca, ca_key, _, _ := testGenerateCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake DECS client CA"},
+		NotBefore:             not_before,
+		NotAfter:              not_before.Add(time.Hour * 24),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	_, _, cert_pem, key_pem := testGenerateCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "terraform"},
+		NotBefore:    not_before,
+		NotAfter:     not_before.Add(time.Hour * 24),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, ca_key)
+	ca_pool := x509.NewCertPool()
+	ca_pool.AddCert(ca)
+	return ca_pool, cert_pem, key_pem
+}
+
+func testTLSConfig(fc *fakeController, authenticator string, args map[string]interface{}) map[string]interface{} {
+	raw := map[string]interface{}{
+		"authenticator":  authenticator,
+		"controller_url": fc.URL(),
+		"oauth2_url":     fc.URL(),
+		"user":           fakeLegacyUser,
+		"password":       fakeLegacyPassword,
+		"app_id":         fakeAppID,
+		"app_secret":     fakeAppSecret,
+		"max_retries":    0,
+	}
+	for key, value := range args {
+		raw[key] = value
+	}
+	return raw
+}
+
+func TestControllerTLS(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	startFakeTLSController(fc, &tls.Config{MaxVersion: tls.VersionTLS12})
+	ca_pem := fakeServerCAPEM(fc)
+
+	ca_file, err := ioutil.TempFile("", "decs-ca-*.pem")
+	if err != nil {
+		t.Fatalf("Failed to create CA file: %s", err)
+	}
+	defer os.Remove(ca_file.Name())
+	ca_file.WriteString(ca_pem)
+	ca_file.Close()
+
+	cases := []struct {
+		name string
+		authenticator string
+		args map[string]interface{}
+		expect_error string
+	}{
+		{"unknown CA", "legacy", nil, "certificate signed by unknown authority"},
+		{"ca_pem", "legacy", map[string]interface{}{"ca_pem": ca_pem}, ""},
+		{"ca_file", "legacy", map[string]interface{}{"ca_file": ca_file.Name()}, ""},
+		{"unverified", "legacy", map[string]interface{}{"allow_unverified_ssl": true}, ""},
+		// Oauth2 token request goes through the same TLS settings
+		{"oauth2 ca_pem", "oauth2", map[string]interface{}{"ca_pem": ca_pem}, ""},
+		{"oauth2 unknown CA", "oauth2", nil, "certificate signed by unknown authority"},
+		{"min version", "legacy", map[string]interface{}{"ca_pem": ca_pem, "tls_min_version": "1.3"}, "protocol version"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := testControllerConfig(t, testTLSConfig(fc, tc.authenticator, tc.args))
+			_, err := config.decsAPICall(context.Background(), "POST", client.ImagesListAPI, &url.Values{})
+			if tc.expect_error == "" && err != nil {
+				t.Errorf("API call over TLS failed: %s", err)
+			}
+			if tc.expect_error != "" && (err == nil || !regexp.MustCompile(tc.expect_error).MatchString(err.Error())) {
+				t.Errorf("Expected error matching %q, got %v", tc.expect_error, err)
+			}
+		})
+	}
+}
+
+func TestControllerTLSClientCertificate(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	client_cas, cert_pem, key_pem := testClientCertificate(t)
+	startFakeTLSController(fc, &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: client_cas})
+	ca_pem := fakeServerCAPEM(fc)
+
+	config := testControllerConfig(t, testTLSConfig(fc, "legacy", map[string]interface{}{"ca_pem": ca_pem}))
+	_, err := config.decsAPICall(context.Background(), "POST", client.ImagesListAPI, &url.Values{})
+	if err == nil {
+		t.Errorf("API call without client certificate succeeded against controller that requires it.")
+	}
+
+	config = testControllerConfig(t, testTLSConfig(fc, "legacy", map[string]interface{}{
+		"ca_pem":      ca_pem,
+		"client_cert": cert_pem,
+		"client_key":  key_pem,
+	}))
+	testListImages(t, config)
+}
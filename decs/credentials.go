@@ -0,0 +1,183 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+)
+
+// credential process is killed if it does not complete within this time
+var credentialProcessTimeout = time.Second * 60
+
+// CredentialProcessOutput is the JSON document that external credential command prints to its stdout.
+// Either JWT (for 'jwt' authentication mode) or application ID and secret (for 'oauth2' mode)
+// should be provided.
+type CredentialProcessOutput struct {
+	JWT string        `json:"jwt"`
+	AppID string      `json:"app_id"`
+	AppSecret string  `json:"app_secret"`
+}
+
+func (config *ControllerCfg) hasJWTSource() bool {
+	// Check if JWT in 'jwt' authentication mode can be re-read from an external source
+	// rather than being a static value from the provider arguments.
+	return config.jwt_file != "" || config.credential_process != ""
+}
+
+func readJWTFile(file_name string) (string, error) {
+	data, err := ioutil.ReadFile(file_name)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read JWT file %q: %s", file_name, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("JWT file %q is empty.", file_name)
+	}
+	return token, nil
+}
+
+func runCredentialProcess(ctx context.Context, command string) (*CredentialProcessOutput, error) {
+	// Run external command that prints credentials in JSON format to its stdout. The command is run
+	// by the system shell, so that it may include arguments, pipes, etc.
+	proc_ctx, cancel := context.WithTimeout(ctx, credentialProcessTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(proc_ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(proc_ctx, "/bin/sh", "-c", command)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.Printf("runCredentialProcess: running credential process")
+	err := cmd.Start()
+	if err == nil {
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err = <-done:
+			if stderr.Len() > 0 {
+				log.Printf("runCredentialProcess: credential process stderr: %s", redactText(stderr.String()))
+			}
+		case <-proc_ctx.Done():
+			// the process is killed on context expiration, but processes it started may still keep
+			// its output open, so we do not wait for them
+		}
+	}
+	if ctx.Err() != nil {
+		// operation was cancelled or timed out while the credential process was running
+		return nil, ctx.Err()
+	}
+	if proc_ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("Credential process did not complete within %s.", credentialProcessTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Credential process failed: %s", err)
+	}
+
+	output := &CredentialProcessOutput{}
+	err = json.Unmarshal(stdout.Bytes(), output)
+	if err != nil {
+		// do not include the output itself in the error as it is likely to contain secrets
+		return nil, fmt.Errorf("Failed to parse JSON output of credential process: %s", err)
+	}
+	return output, nil
+}
+
+func (config *ControllerCfg) loadCredentials(ctx context.Context) error {
+	// Load credentials from jwt_file or credential_process for the selected authenticator mode.
+	// This method must be called with auth_mutex locked.
+	switch config.auth_mode_code {
+	case MODE_JWT:
+		var token string
+		if config.jwt_file != "" {
+			file_token, err := readJWTFile(config.jwt_file)
+			if err != nil {
+				return err
+			}
+			token = file_token
+		} else if config.credential_process != "" {
+			output, err := runCredentialProcess(ctx, config.credential_process)
+			if err != nil {
+				return err
+			}
+			if output.JWT == "" {
+				return fmt.Errorf("Credential process provided no 'jwt' for authenticator mode 'jwt'.")
+			}
+			token = output.JWT
+		} else {
+			return nil
+		}
+		err := config.setJWT(token)
+		if err != nil {
+			log.Printf("loadCredentials: JWT expiration time is unknown: %s", err)
+		}
+	case MODE_OAUTH2:
+		if config.credential_process == "" {
+			return nil
+		}
+		output, err := runCredentialProcess(ctx, config.credential_process)
+		if err != nil {
+			return err
+		}
+		if output.AppID == "" || output.AppSecret == "" {
+			return fmt.Errorf("Credential process provided no 'app_id' and 'app_secret' for authenticator mode 'oauth2'.")
+		}
+		config.app_id = output.AppID
+		config.app_secret = output.AppSecret
+	}
+	return nil
+}
+
+func (config *ControllerCfg) obtainJWT(ctx context.Context) (string, error) {
+	// Obtain fresh JWT: request it from Oauth2 provider in 'oauth2' mode or re-read it from jwt_file
+	// or credential_process in 'jwt' mode. Returns empty string without error if the JWT is static and
+	// cannot be refreshed. This method must be called with auth_mutex locked.
+	switch config.auth_mode_code {
+	case MODE_OAUTH2:
+		err := config.loadCredentials(ctx)
+		if err != nil {
+			return "", err
+		}
+		return config.getOAuth2JWT(ctx)
+	case MODE_JWT:
+		if !config.hasJWTSource() {
+			return "", nil
+		}
+		err := config.loadCredentials(ctx)
+		if err != nil {
+			return "", err
+		}
+		return config.jwt, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/terraform-provider-decs/decs/client"
+)
+
+func testTempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "decs-credentials")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func testWriteFile(t *testing.T, file_name string, content string, mode os.FileMode) {
+	if err := ioutil.WriteFile(file_name, []byte(content), mode); err != nil {
+		t.Fatalf("Failed to write %q: %s", file_name, err)
+	}
+}
+
+func testCredentialScript(t *testing.T, dir string, name string, body string) string {
+	// Write stub credential process as shell script and return the command to run it
+	if runtime.GOOS == "windows" {
+		t.Skip("Stub credential process requires POSIX shell.")
+	}
+	script := filepath.Join(dir, name)
+	testWriteFile(t, script, "#!/bin/sh\n" + body + "\n", 0755)
+	return script
+}
+
+func TestControllerJWTFile(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+	jwt_file := filepath.Join(dir, "jwt")
+	testWriteFile(t, jwt_file, fc.issueJWT(fakeLegacyUser, time.Hour) + "\n", 0600)
+
+	config := testControllerConfig(t, map[string]interface{}{
+		"authenticator":  "jwt",
+		"controller_url": fc.URL(),
+		"oauth2_url":     fc.URL(),
+		"jwt_file":       jwt_file,
+		"max_retries":    0,
+		"disable_cache":  true,
+	})
+	testListImages(t, config)
+
+	// vault agent rotates the JWT and the old one is no longer accepted
+	fc.revokeCredentials()
+	testWriteFile(t, jwt_file, fc.issueJWT(fakeLegacyUser, time.Hour), 0600)
+	testListImages(t, config)
+	if count := fc.callCount(client.ImagesListAPI); count != 3 {
+		t.Errorf("API was called %d times, expected rejected call to be repeated once with JWT re-read from file.", count)
+	}
+
+	// JWT file that became empty or is gone is reported
+	testWriteFile(t, jwt_file, "  \n", 0600)
+	fc.revokeCredentials()
+	_, err := config.decsAPICall(context.Background(), "POST", client.ImagesListAPI, &url.Values{})
+	if err == nil || !regexp.MustCompile(`JWT file ".*" is empty`).MatchString(err.Error()) {
+		t.Errorf("Expected empty JWT file error, got %v", err)
+	}
+	os.Remove(jwt_file)
+	_, err = config.decsAPICall(context.Background(), "POST", client.ImagesListAPI, &url.Values{})
+	if err == nil || !regexp.MustCompile(`Failed to read JWT file`).MatchString(err.Error()) {
+		t.Errorf("Expected missing JWT file error, got %v", err)
+	}
+}
+
+func TestControllerCredentialProcess(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	jwt_script := testCredentialScript(t, dir, "jwt.sh", `echo '{"jwt": "` + fc.issueJWT(fakeLegacyUser, time.Hour) + `"}'`)
+	app_script := testCredentialScript(t, dir, "app.sh", `echo '{"app_id": "` + fakeAppID + `", "app_secret": "` + fakeAppSecret + `"}'`)
+
+	cases := []struct {
+		name string
+		authenticator string
+		command string
+		expect_error string
+	}{
+		{"jwt", "jwt", jwt_script, ""},
+		{"oauth2", "oauth2", app_script, ""},
+		{"non-zero exit", "jwt", testCredentialScript(t, dir, "fail.sh", "echo 'vault is sealed' >&2; exit 3"), "Credential process failed: exit status 3"},
+		{"no output", "jwt", testCredentialScript(t, dir, "silent.sh", "true"), "Failed to parse JSON output of credential process"},
+		{"not JSON", "jwt", testCredentialScript(t, dir, "text.sh", "echo token"), "Failed to parse JSON output of credential process"},
+		{"no jwt", "jwt", app_script, "Credential process provided no 'jwt'"},
+		{"no app secret", "oauth2", jwt_script, "Credential process provided no 'app_id' and 'app_secret'"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := testControllerConfig(t, map[string]interface{}{
+				"authenticator":      tc.authenticator,
+				"controller_url":     fc.URL(),
+				"oauth2_url":         fc.URL(),
+				"credential_process": tc.command,
+				"max_retries":        0,
+			})
+			_, err := config.decsAPICall(context.Background(), "POST", client.ImagesListAPI, &url.Values{})
+			if tc.expect_error == "" && err != nil {
+				t.Errorf("API call with credentials from credential process failed: %s", err)
+			}
+			if tc.expect_error != "" && (err == nil || !regexp.MustCompile(regexp.QuoteMeta(tc.expect_error)).MatchString(err.Error())) {
+				t.Errorf("Expected error %q, got %v", tc.expect_error, err)
+			}
+		})
+	}
+}
+
+func TestCredentialProcessTimeout(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+	command := testCredentialScript(t, dir, "hang.sh", "sleep 10")
+	saved_timeout := credentialProcessTimeout
+	credentialProcessTimeout = time.Millisecond * 100
+	defer func() { credentialProcessTimeout = saved_timeout }()
+
+	_, err := runCredentialProcess(context.Background(), command)
+	if err == nil || !regexp.MustCompile("Credential process did not complete within").MatchString(err.Error()) {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+}
@@ -18,10 +18,8 @@ limitations under the License.
 package decs
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
-	"net/url"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
@@ -33,24 +31,23 @@ func dataSourceImageRead(d *schema.ResourceData, m interface{}) error {
 	rgid, rgid_set := d.GetOk("rgid")
 	tenant_id, tenant_set := d.GetOk("tenant_id")
 
-	controller := m.(*ControllerCfg)
-	url_values := &url.Values{}
+	// image list is not filtered by tenant and/or resource group, which are not set
+	list_tenant_id := 0
 	if tenant_set {
-		url_values.Add("accountId", fmt.Sprintf("%d",tenant_id.(int)))
+		list_tenant_id = tenant_id.(int)
 	}
+	list_rgid := 0
 	if rgid_set {
-		url_values.Add("cloudspaceId", fmt.Sprintf("%d",rgid.(int)))
-	}
-	body_string, err := controller.decsAPICall("POST", ImagesListAPI, url_values)
-	if err != nil {
-		return err
+		list_rgid = rgid.(int)
 	}
 
-	log.Printf("dataSourceImageRead: ready to decode response body")
-	model := ImagesListResp{}
-	err = json.Unmarshal([]byte(body_string), &model)
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutRead)
+	defer cancel()
+
+	model, err := controller.api.Images.List(ctx, list_tenant_id, list_rgid)
 	if err != nil {
-		return err
+		return explainAPIError(err, fmt.Sprintf("list images to find image %q", name))
 	}
 
 	log.Printf("%#v", model)
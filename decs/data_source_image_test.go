@@ -0,0 +1,46 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestAccDataSourceImage(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders(),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccImageDataSourceConfig, fakeImageName),
+				Check: resource.TestCheckResourceAttr("data.decs_image.os", "id", fmt.Sprintf("%d", fakeImageID)),
+			},
+			{
+				Config:      testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccImageDataSourceConfig, "No Such Image"),
+				ExpectError: regexp.MustCompile(`Cannot find OS Image name "No Such Image"`),
+			},
+		},
+	})
+}
@@ -19,7 +19,6 @@ package decs
 
 import (
 
-	"encoding/json"
 	"fmt"
 	"log"
 	// "net/url"
@@ -27,19 +26,13 @@ import (
 	"github.com/hashicorp/terraform/helper/schema"
 	// "github.com/hashicorp/terraform/helper/validation"
 
+	"github.com/terraform-provider-decs/decs/client"
+
 )
 
-func flattenResgroup(d *schema.ResourceData, rg_facts string) error {
+func flattenResgroup(d *schema.ResourceData, details *client.CloudspacesGetResp) error {
 	// NOTE: this function modifies ResourceData argument - as such it should never be called
 	// from resourceRsgroupExists(...) method
-	log.Printf("%s", rg_facts)
-	log.Printf("flattenResgroup: ready to decode response body from %q", CloudspacesGetAPI)
-	details := CloudspacesGetResp{}
-	err := json.Unmarshal([]byte(rg_facts), &details)
-	if err != nil {
-		return err
-	}
-
 	log.Printf("flattenResgroup: decoded ResGroup name %q / ID %d, tenant ID %d, public IP %q", 
 				details.Name, details.ID, details.TenantID, details.PublicIP)
 
@@ -50,7 +43,7 @@ func flattenResgroup(d *schema.ResourceData, rg_facts string) error {
 	d.Set("public_ip", details.PublicIP) // legacy field - this may be obsoleted when new network segments are implemented
 
 	log.Printf("flattenResgroup: calling flattenQuota()")
-	if err = d.Set("quotas", flattenQuota(details.Quotas)); err != nil {
+	if err := d.Set("quotas", flattenQuota(details.Quotas)); err != nil {
 		return err
 	}
 
@@ -58,9 +51,13 @@ func flattenResgroup(d *schema.ResourceData, rg_facts string) error {
 }
 
 func dataSourceResgroupRead(d *schema.ResourceData, m interface{}) error {
-	rg_facts, err := utilityResgroupCheckPresence(d, m)
-	if rg_facts == "" {
-		// if empty string is returned from utilityResgroupCheckPresence then there is no
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutRead)
+	defer cancel()
+
+	rg_facts, err := utilityResgroupCheckPresence(ctx, d, m)
+	if rg_facts == nil {
+		// if nil is returned from utilityResgroupCheckPresence then there is no
 		// such resource group and err tells so - just return it to the calling party 
 		d.SetId("") // ensure ID is empty
 		return err
@@ -0,0 +1,74 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestAccDataSourceResgroup(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	rgid := fc.addCloudspace("tf-existing-rg")
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders(),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(`
+data "decs_resgroup" "rg" {
+  name   = "tf-existing-rg"
+  tenant = %q
+}
+`, fakeTenantName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.decs_resgroup.rg", "id", fmt.Sprintf("%d", rgid)),
+					resource.TestCheckResourceAttr("data.decs_resgroup.rg", "tenant_id", fmt.Sprintf("%d", fakeTenantID)),
+					resource.TestCheckResourceAttr("data.decs_resgroup.rg", "quotas.0.cpu", "-1"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccDataSourceResgroupAmbiguousName(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	fc.addCloudspace("tf-existing-rg")
+	fc.addCloudspace("tf-existing-rg")
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders(),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(`
+data "decs_resgroup" "rg" {
+  name   = "tf-existing-rg"
+  tenant = %q
+}
+`, fakeTenantName),
+				ExpectError: regexp.MustCompile(`Found 2 resource groups named "tf-existing-rg"`),
+			},
+		},
+	})
+}
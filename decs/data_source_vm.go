@@ -19,25 +19,20 @@ package decs
 
 import (
 
-	"encoding/json"
 	"fmt"
 	"log"
 	// "net/url"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
+
+	"github.com/terraform-provider-decs/decs/client"
 )
 
-func flattenVm(d *schema.ResourceData, vm_facts string) error {
+func flattenVm(d *schema.ResourceData, model *client.MachinesGetResp) error {
 	// NOTE: this function modifies ResourceData argument - as such it should never be called
 	// from resourceVmExists(...) method
-	model := MachinesGetResp{}
-	log.Printf("flattenVm: ready to unmarshal string %q", vm_facts) 
-	err := json.Unmarshal([]byte(vm_facts), &model)
-	if err != nil {
-		return err
-	}
-
+	var err error
 	log.Printf("flattenVm: model.ID %d, model.ResGroupID %d", model.ID, model.ResGroupID)
 			   
 	d.SetId(fmt.Sprintf("%d", model.ID))
@@ -59,11 +54,10 @@ func flattenVm(d *schema.ResourceData, vm_facts string) error {
 		return err
 	}
 
-	if len(model.DataDisks) > 0 {
-		log.Printf("flattenVm: calling flattenDataDisks")
-		if err = d.Set("data_disks", flattenDataDisks(model.DataDisks)); err != nil {
-			return err
-		}
+	// data disks list is set even if it is empty, as all data disks may have been removed
+	log.Printf("flattenVm: calling flattenDataDisks")
+	if err = d.Set("data_disks", flattenDataDisks(model.DataDisks, d.Get("data_disks").([]interface{}))); err != nil {
+		return err
 	}
 
 	if len(model.NICs) > 0 {
@@ -98,9 +92,13 @@ func flattenVm(d *schema.ResourceData, vm_facts string) error {
 }
 
 func dataSourceVmRead(d *schema.ResourceData, m interface{}) error {
-	vm_facts, err := utilityVmCheckPresence(d, m)
-	if vm_facts == "" {
-		// if empty string is returned from utilityVmCheckPresence then there is no
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutRead)
+	defer cancel()
+
+	vm_facts, err := utilityVmCheckPresence(ctx, d, m)
+	if vm_facts == nil {
+		// if nil is returned from utilityVmCheckPresence then there is no
 		// such VM and err tells so - just return it to the calling party 
 		d.SetId("") // ensure ID is empty
 		return err
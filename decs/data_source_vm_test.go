@@ -0,0 +1,54 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestAccDataSourceVm(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	rgid := fc.addCloudspace("tf-existing-rg")
+	vm_id := fc.addMachine(rgid, "tf-existing-vm", 4, 4096)
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders(),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(`
+data "decs_vm" "vm" {
+  name = "tf-existing-vm"
+  rgid = %d
+}
+`, rgid),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.decs_vm.vm", "id", fmt.Sprintf("%d", vm_id)),
+					resource.TestCheckResourceAttr("data.decs_vm.vm", "cpu", "4"),
+					resource.TestCheckResourceAttr("data.decs_vm.vm", "ram", "4096"),
+					resource.TestCheckResourceAttr("data.decs_vm.vm", "nics.#", "1"),
+					resource.TestCheckResourceAttr("data.decs_vm.vm", "user", "user"),
+				),
+			},
+		},
+	})
+}
@@ -19,10 +19,14 @@ package decs
 
 import (
 
+	"fmt"
 	"log"
+	"sort"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
+
+	"github.com/terraform-provider-decs/decs/client"
 )
 
 func makeDisksConfig(arg_list []interface{}) (disks []DiskConfig, count int) {
@@ -45,34 +49,60 @@ func makeDisksConfig(arg_list []interface{}) (disks []DiskConfig, count int) {
 	return disks, count
 }
 
-func flattenDataDisks(disks []DataDiskRecord) []interface{} {
-	var length = 0
-	for _, value := range disks {
-		if value.DiskType == "D" {
-			length += 1
+func flattenDataDisks(disks []client.DataDiskRecord, prior []interface{}) []interface{} {
+	// Data disks are listed in the order of their labels in prior list, so that the list does not
+	// show spurious changes when the controller returns disks in a different order. Disks not found 
+	// in the prior list follow in the order they were returned. Settings that the controller does 
+	// not report (pool, provider and keep_on_remove) are taken from the prior list.
+	prior_index := make(map[string]int)
+	prior_elems := make(map[string]map[string]interface{})
+	for index, value := range prior {
+		prior_elem, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		label, _ := prior_elem["label"].(string)
+		if _, dup := prior_index[label]; !dup {
+			prior_index[label] = index
+			prior_elems[label] = prior_elem
 		}
 	}
-	log.Printf("flattenDataDisks: found %d disks with D type", length)
-
-	result := make([]interface{}, length)
-	if length == 0 {
-		return result
-	}
-
-	elem := make(map[string]interface{})
 
-	var subindex = 0
+	var data_disks []client.DataDiskRecord
 	for _, value := range disks {
 		if value.DiskType == "D" {
-			elem["label"] = value.Label
-			elem["size"] = value.SizeMax
-			elem["disk_id"] = value.ID
-			elem["pool"] = "default"
-			elem["provider"] = "default"
-			result[subindex] = elem
-			subindex += 1
+			data_disks = append(data_disks, value)
 		}
-		
+	}
+	log.Printf("flattenDataDisks: found %d disks with D type", len(data_disks))
+	sort.SliceStable(data_disks, func(i, j int) bool {
+		index_i, known_i := prior_index[data_disks[i].Label]
+		index_j, known_j := prior_index[data_disks[j].Label]
+		if known_i && known_j {
+			return index_i < index_j
+		}
+		return known_i && !known_j
+	})
+
+	result := make([]interface{}, len(data_disks))
+	for index, value := range data_disks {
+		elem := make(map[string]interface{})
+		elem["label"] = value.Label
+		elem["size"] = value.SizeMax
+		elem["disk_id"] = value.ID
+		elem["pool"] = "default"
+		elem["provider"] = "default"
+		if prior_elem, ok := prior_elems[value.Label]; ok {
+			for _, key := range []string{"pool", "provider"} {
+				if prior_value, ok := prior_elem[key].(string); ok && prior_value != "" {
+					elem[key] = prior_value
+				}
+			}
+			if keep, ok := prior_elem["keep_on_remove"]; ok {
+				elem["keep_on_remove"] = keep
+			}
+		}
+		result[index] = elem
 	}
 
 	return result
@@ -128,3 +158,67 @@ func diskSubresourceSchema() map[string]*schema.Schema {
 
 	return rets
 }
+
+func dataDiskSubresourceSchema() map[string]*schema.Schema {
+	// Data disks, unlike boot disk, can be added to and removed from existing VM
+	rets := diskSubresourceSchema()
+	rets["keep_on_remove"] = &schema.Schema {
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		Description: "Only detach this disk from the VM when it is removed from the configuration, do not delete it.",
+	}
+	return rets
+}
+
+func diffDataDisks(old_list []interface{}, new_list []interface{}) (added []DiskConfig, removed []DiskConfig, grown []DiskConfig, err error) {
+	// Compare data disk lists by disk label. Removed disks carry their ID and keep_on_remove
+	// setting from the old list, grown disks carry their ID from the old list and the new size.
+	// Error is returned if disk labels are not unique, if a disk would have to shrink or to move
+	// to another pool or storage provider.
+	old_disks := make(map[string]map[string]interface{})
+	for _, value := range old_list {
+		elem := value.(map[string]interface{})
+		old_disks[elem["label"].(string)] = elem
+	}
+	new_labels := make(map[string]bool)
+	for _, value := range new_list {
+		elem := value.(map[string]interface{})
+		label := elem["label"].(string)
+		if new_labels[label] {
+			return nil, nil, nil, fmt.Errorf("Duplicate data disk label %q. Data disks are told apart by their labels, so labels must be unique.", label)
+		}
+		new_labels[label] = true
+
+		size := elem["size"].(int)
+		old_elem, ok := old_disks[label]
+		if !ok {
+			added = append(added, DiskConfig{Label: label, Size: size, Pool: elem["pool"].(string), Provider: elem["provider"].(string)})
+			continue
+		}
+		old_size := old_elem["size"].(int)
+		if size < old_size {
+			return nil, nil, nil, fmt.Errorf("Cannot shrink data disk %q from %d GB to %d GB. Data disks can only grow.", label, old_size, size)
+		}
+		for _, key := range []string{"pool", "provider"} {
+			old_setting, _ := old_elem[key].(string)
+			new_setting, _ := elem[key].(string)
+			if new_setting != old_setting {
+				return nil, nil, nil, fmt.Errorf("Cannot change %s of data disk %q from %q to %q. Existing disk cannot be moved, remove it and add a disk with a new label instead.", 
+				                                  key, label, old_setting, new_setting)
+			}
+		}
+		if size > old_size {
+			grown = append(grown, DiskConfig{Label: label, Size: size, ID: old_elem["disk_id"].(int)})
+		}
+	}
+	for _, value := range old_list {
+		elem := value.(map[string]interface{})
+		label := elem["label"].(string)
+		if !new_labels[label] {
+			keep, _ := elem["keep_on_remove"].(bool)
+			removed = append(removed, DiskConfig{Label: label, ID: elem["disk_id"].(int), KeepOnRemove: keep})
+		}
+	}
+	return added, removed, grown, nil
+}
@@ -0,0 +1,203 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package decs
+
+import (
+
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+)
+
+// DECS installation may have several controller nodes behind separate addresses. API calls are sent
+// to one node at a time. When the node fails with a connection error or 502, 503 or 504 response, it is
+// marked down and the next node that passes health check takes over. API call that fails this way is
+// repeated on the next node only if it is read-only or if it has not reached the failed node at all. Node marked down is not used again until
+// endpointDownInterval passes, unless all other nodes are down too.
+//
+// Session key and JWT are not tied to a particular node, so the credential obtained from one node
+// is used with the next one. If the next node rejects it, the credential is renewed as usual.
+
+// how long the failed controller node is skipped when choosing the node to switch to
+var endpointDownInterval = time.Second * 60
+
+// how long to wait for the controller node to answer health check
+var endpointProbeTimeout = time.Second * 10
+
+type controllerEndpoints struct {
+	mutex sync.Mutex
+	urls []string
+	active int            // index of the node in urls that API calls are sent to
+	failed_at []time.Time // when each node was last marked down, zero if never
+}
+
+func newControllerEndpoints(urls []string) *controllerEndpoints {
+	return &controllerEndpoints{
+		urls:      urls,
+		failed_at: make([]time.Time, len(urls)),
+	}
+}
+
+func (endpoints *controllerEndpoints) current() string {
+	endpoints.mutex.Lock()
+	defer endpoints.mutex.Unlock()
+	return endpoints.urls[endpoints.active]
+}
+
+func (endpoints *controllerEndpoints) markDown(node_url string) {
+	endpoints.mutex.Lock()
+	defer endpoints.mutex.Unlock()
+	for index, url := range endpoints.urls {
+		if url == node_url {
+			endpoints.failed_at[index] = time.Now()
+		}
+	}
+}
+
+func (endpoints *controllerEndpoints) candidates(failed_url string) []int {
+	// Return indexes of the nodes to try instead of the failed one, in the order they are configured
+	// starting after the failed node. Nodes recently marked down are skipped.
+	endpoints.mutex.Lock()
+	defer endpoints.mutex.Unlock()
+	var indexes []int
+	for step := 1; step < len(endpoints.urls); step++ {
+		index := (endpoints.active + step) % len(endpoints.urls)
+		if endpoints.urls[index] == failed_url {
+			continue
+		}
+		if !endpoints.failed_at[index].IsZero() && time.Since(endpoints.failed_at[index]) < endpointDownInterval {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+func (endpoints *controllerEndpoints) switchTo(failed_url string, index int) bool {
+	// Make the node at index active unless another API call has already switched away from the failed node.
+	endpoints.mutex.Lock()
+	defer endpoints.mutex.Unlock()
+	if endpoints.urls[endpoints.active] != failed_url {
+		return false
+	}
+	endpoints.active = index
+	return true
+}
+
+func isNodeFailure(status_code int, err error) bool {
+	// Check if failed request indicates that the controller node itself is in trouble, rather than
+	// the request was rejected by a healthy node.
+	if err != nil {
+		// only transport errors are attributed to the node, not the cancellation of the operation
+		var url_err *url.Error
+		return errors.As(err, &url_err) && !isContextError(err)
+	}
+	return isGatewayFailure(status_code)
+}
+
+func isGatewayFailure(status_code int) bool {
+	// Other 5xx codes, e.g. 500, are usually returned by a healthy node that could not process the request,
+	// e.g. because of bad parameters, so they say nothing about the node itself
+	switch status_code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func isRequestNotSent(err error) bool {
+	// Failure to establish connection means that the request has not reached the controller node.
+	var op_err *net.OpError
+	return errors.As(err, &op_err) && op_err.Op == "dial"
+}
+
+func (config *ControllerCfg) failover(ctx context.Context, failed_url string) bool {
+	// Mark the failed controller node down and switch to the next healthy node. Return true if API
+	// calls are now directed to another node, either by this call or by a concurrent one.
+	if config.recorder.replaying() {
+		return false
+	}
+	config.endpoints.markDown(failed_url)
+	for _, index := range config.endpoints.candidates(failed_url) {
+		node_url := config.endpoints.urls[index]
+		err := config.probeEndpoint(ctx, node_url)
+		if err != nil {
+			log.Printf("failover: DECS controller node %q failed health check: %s", node_url, err)
+			config.endpoints.markDown(node_url)
+			continue
+		}
+		if config.endpoints.switchTo(failed_url, index) {
+			log.Printf("failover: switched from DECS controller node %q to %q", failed_url, node_url)
+		}
+		return true
+	}
+	// another API call may have found healthy node while we were probing
+	return config.endpoints.current() != failed_url
+}
+
+func (config *ControllerCfg) probeEndpoint(ctx context.Context, node_url string) error {
+	// Check that the controller node answers HTTP requests. Any response other than 502, 503 or 504
+	// means the node is up, as the health check request is not authenticated.
+	probe_ctx, cancel := context.WithTimeout(ctx, endpointProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(probe_ctx, "GET", node_url + "/restmachine/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := config.cc_client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if isGatewayFailure(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (config *ControllerCfg) doWithFailover(ctx context.Context, new_request func(node_url string) (*http.Request, error)) (*http.Response, error) {
+	// Send the request made by new_request to the active controller node, repeating it on the next
+	// healthy node if the active one fails. Only use it for requests that are safe to repeat.
+	for {
+		node_url := config.endpoints.current()
+		req, err := new_request(node_url)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := config.cc_client.Do(req)
+		status_code := 0
+		if err == nil {
+			status_code = resp.StatusCode
+		}
+		if !isNodeFailure(status_code, err) || !config.failover(ctx, node_url) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		log.Printf("doWithFailover: request to DECS controller node %q failed, repeating on %q", node_url, config.endpoints.current())
+	}
+}
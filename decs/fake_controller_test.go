@@ -0,0 +1,1192 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/terraform-provider-decs/decs/client"
+)
+
+// Fake DECS controller for offline acceptance tests. It keeps cloud state in memory, implements
+// cloudapi endpoints used by the provider and replies in the same Python literal style as the
+// real controller does. The same server acts as Oauth2 provider, so that all three authenticator
+// modes can be tested.
+
+const (
+	fakeLegacyUser     = "tf-user"
+	fakeLegacyPassword = "tf-password"
+	fakeAppID          = "tf-app"
+	fakeAppSecret      = "tf-app-secret"
+	fakeIssuer         = "fake-sso"
+	fakeTenantName     = "tf-tenant"
+	fakeTenantID       = 101
+	fakeGridID         = 7
+	fakeImageName      = "Ubuntu 18.04 v1.2"
+	fakeImageID        = 301
+	fakeExtNetID       = 6
+)
+
+type fakeController struct {
+	server *httptest.Server
+	mutex sync.Mutex
+
+	sessions map[string]bool   // session keys issued in legacy mode
+	tokens map[string]bool     // JWTs issued by the Oauth2 endpoint or registered by the test
+	next_id int
+	calls map[string]int       // number of calls per API path
+	auth_kinds map[string]int  // number of authenticated requests per kind: "session_key", "bearer", "access_token"
+
+	tenants []client.TenantRecord
+	images []client.ImageRecord
+	extnets []client.ExtNetworkRecord
+	cloudspaces map[int]*client.CloudspacesGetResp
+	machines map[int]*client.MachinesGetResp
+	disks map[int]*client.DataDiskRecord
+	portforwards []client.PortforwardRecord
+
+	settle_gets int            // number of get calls a new object spends in transition, 0 if it is created ready
+	vm_settle_status string    // status new VM ends up in after transition, RUNNING if empty
+	settling map[int]*fakeTransition
+	hanging map[string]bool    // APIs that do not respond until the client abandons the request
+	failures map[string]*fakeFailure // APIs that fail with the given status code before being served
+	plain_replies map[string]string  // APIs that reply with plain text instead of Python literal
+	removed map[string]bool    // APIs this controller generation does not provide
+	catalog_missing bool       // controller provides no API catalog
+	resize_needs_stop bool     // running VM cannot be resized
+	power_gets int             // number of get calls VM keeps its old status after stop or start, 0 if it changes at once
+	upper_proto bool           // report protocol of port forwarding rules in upper case
+	deny_tokens bool           // reject all JWTs, including newly issued ones
+
+	old_config_file string     // value of DECS_CONFIG_FILE to restore on Close()
+	config_file_set bool
+}
+
+func newFakeController() *fakeController {
+	fc := &fakeController{
+		sessions:    make(map[string]bool),
+		tokens:      make(map[string]bool),
+		next_id:     1000,
+		calls:       make(map[string]int),
+		auth_kinds:  make(map[string]int),
+		cloudspaces: make(map[int]*client.CloudspacesGetResp),
+		machines:    make(map[int]*client.MachinesGetResp),
+		disks:       make(map[int]*client.DataDiskRecord),
+		settling:    make(map[int]*fakeTransition),
+		hanging:     make(map[string]bool),
+		failures:    make(map[string]*fakeFailure),
+		plain_replies: make(map[string]string),
+		removed:     make(map[string]bool),
+	}
+	fc.tenants = []client.TenantRecord{
+		{ID: fakeTenantID, Name: fakeTenantName},
+	}
+	fc.images = []client.ImageRecord{
+		{ID: fakeImageID, Name: fakeImageName, Status: "CREATED", ImageType: "Linux", Size: 10, TenantID: 0},
+	}
+	fc.extnets = []client.ExtNetworkRecord{
+		{ID: fakeExtNetID, IPRange: "10.1.0.0/24"},
+	}
+
+	fc.server = httptest.NewServer(http.HandlerFunc(fc.serveHTTP))
+
+	// make sure DECS config file of the user running the tests does not interfere
+	fc.old_config_file, fc.config_file_set = os.LookupEnv(ConfigFileEnvVar)
+	os.Setenv(ConfigFileEnvVar, os.DevNull)
+
+	return fc
+}
+
+func (fc *fakeController) Close() {
+	fc.server.Close()
+	if fc.config_file_set {
+		os.Setenv(ConfigFileEnvVar, fc.old_config_file)
+	} else {
+		os.Unsetenv(ConfigFileEnvVar)
+	}
+}
+
+func (fc *fakeController) URL() string {
+	return fc.server.URL
+}
+
+func (fc *fakeController) newID() int {
+	fc.next_id += 1
+	return fc.next_id
+}
+
+func (fc *fakeController) issueJWT(username string, validity time.Duration) string {
+	// Issue JWT that the fake controller will accept, e.g. to be used in jwt authenticator mode
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return fc.newJWT(username, validity)
+}
+
+func (fc *fakeController) newJWT(username string, validity time.Duration) string {
+	// Signature of JWT is not checked by the provider, so any signing key will do.
+	// This method must be called with the mutex locked.
+	claims := jwt.MapClaims{
+		"username": username,
+		"iss":      fakeIssuer,
+		"exp":      time.Now().Add(validity).Unix(),
+		"jti":      strconv.Itoa(fc.newID()), // tokens issued within the same second must differ
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("fake-signing-key"))
+	fc.tokens[token] = true
+	return token
+}
+
+func (fc *fakeController) hang(api_name string) {
+	// Make the API never respond, like overloaded controller would do
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	fc.hanging[api_name] = true
+}
+
+type fakeFailure struct {
+	status int
+	calls_left int
+}
+
+func (fc *fakeController) failCalls(api_name string, status int, count int) {
+	// Make the next count calls of the API fail with the status code, like overloaded or broken controller would do
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	fc.failures[api_name] = &fakeFailure{status: status, calls_left: count}
+}
+
+func (fc *fakeController) replyPlainText(api_name string, text string) {
+	// Make the API reply with plain text, as some controller APIs do, after handling the request as usual
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	fc.plain_replies[api_name] = text
+}
+
+func (fc *fakeController) removeAPI(api_name string) {
+	// Make the fake behave like controller of a generation that does not provide the API
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	fc.removed[api_name] = true
+}
+
+func (fc *fakeController) revokeCredentials() {
+	// Invalidate all issued session keys and JWTs, as the controller does when sessions expire
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	fc.sessions = make(map[string]bool)
+	fc.tokens = make(map[string]bool)
+}
+
+func (fc *fakeController) callCount(api_name string) int {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return fc.calls[api_name]
+}
+
+func (fc *fakeController) authCount(kind string) int {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return fc.auth_kinds[kind]
+}
+
+//
+// seeding of the fake cloud state by tests
+//
+func (fc *fakeController) addCloudspace(name string) int {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return fc.createCloudspace(fakeTenantID, name, "fake-location", client.QuotaRecord{Cpu: -1, Ram: -1, Disk: -1, NetTraffic: -1, ExtIPs: -1})
+}
+
+func (fc *fakeController) addMachine(rgid int, name string, cpu int, ram int) int {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return fc.createMachine(rgid, name, "", cpu, ram, fakeImageID, 10)
+}
+
+func (fc *fakeController) removeCloudspace(name string) {
+	// delete resource group behind the provider's back, as another user of the cloud would do
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	for id, rg := range fc.cloudspaces {
+		if rg.Name == name {
+			delete(fc.cloudspaces, id)
+		}
+	}
+}
+
+//
+// inspection of the fake cloud state by tests
+//
+func (fc *fakeController) findCloudspace(name string) *client.CloudspacesGetResp {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	for _, rg := range fc.cloudspaces {
+		if rg.Name == name {
+			rg_copy := *rg
+			return &rg_copy
+		}
+	}
+	return nil
+}
+
+func (fc *fakeController) findMachine(name string) *client.MachinesGetResp {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	for _, vm := range fc.machines {
+		if vm.Name == name {
+			vm_copy := *vm
+			return &vm_copy
+		}
+	}
+	return nil
+}
+
+func (fc *fakeController) machinePortforwards(vm_id int) []client.PortforwardRecord {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	var result []client.PortforwardRecord
+	for _, rule := range fc.portforwards {
+		if rule.VmID == vm_id {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+func (fc *fakeController) removePortforward(ext_port int) {
+	// delete port forwarding rule behind the provider's back
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	var rules []client.PortforwardRecord
+	for _, rule := range fc.portforwards {
+		if rule.ExtPort != strconv.Itoa(ext_port) {
+			rules = append(rules, rule)
+		}
+	}
+	fc.portforwards = rules
+}
+
+func (fc *fakeController) diskCount() int {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return len(fc.disks)
+}
+
+func (fc *fakeController) objectCount() int {
+	// total number of resource groups, VMs and data disks in the fake cloud
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return len(fc.cloudspaces) + len(fc.machines) + len(fc.disks)
+}
+
+//
+// state changes - must be called with the mutex locked
+//
+type fakeTransition struct {
+	gets_left int     // get calls left until the object settles, the last of them sees settled status
+	settled string
+}
+
+func (fc *fakeController) startTransition(id int, transitional string, settled string) string {
+	// Return initial status of the new object, which stays in transition for settle_gets get calls.
+	return fc.transition(id, fc.settle_gets, transitional, settled)
+}
+
+func (fc *fakeController) transition(id int, gets int, transitional string, settled string) string {
+	if gets == 0 {
+		return settled
+	}
+	fc.settling[id] = &fakeTransition{gets_left: gets, settled: settled}
+	return transitional
+}
+
+func (fc *fakeController) machineSettled(w http.ResponseWriter, vm *client.MachinesGetResp) bool {
+	// Like the real controller, refuse to reconfigure VM that is still being deployed
+	if _, ok := fc.settling[int(vm.ID)]; ok {
+		fc.fail(w, http.StatusConflict, fmt.Sprintf("Machine %d is in status %s", vm.ID, vm.Status))
+		return false
+	}
+	return true
+}
+
+func (fc *fakeController) advanceTransition(id int, status *string) {
+	transition, ok := fc.settling[id]
+	if !ok {
+		return
+	}
+	transition.gets_left -= 1
+	if transition.gets_left <= 0 {
+		*status = transition.settled
+		delete(fc.settling, id)
+	}
+}
+
+func (fc *fakeController) createCloudspace(tenant_id int, name string, location string, quotas client.QuotaRecord) int {
+	id := fc.newID()
+	fc.cloudspaces[id] = &client.CloudspacesGetResp{
+		ID:         uint(id),
+		Name:       name,
+		Status:     fc.startTransition(id, "DEPLOYING", "DEPLOYED"),
+		TenantID:   tenant_id,
+		GridID:     fakeGridID,
+		Location:   location,
+		ExtIP:      fmt.Sprintf("10.1.0.%d", id % 250 + 2),
+		PublicIP:   fmt.Sprintf("10.1.0.%d", id % 250 + 2),
+		Quotas:     quotas,
+		CreateTime: uint64(time.Now().Unix()),
+	}
+	return id
+}
+
+func (fc *fakeController) createMachine(rgid int, name string, description string, cpu int, ram int, image_id int, boot_disk int) int {
+	id := fc.newID()
+	settled := fc.vm_settle_status
+	if settled == "" {
+		settled = "RUNNING"
+	}
+	fc.machines[id] = &client.MachinesGetResp{
+		ID:          uint(id),
+		ResGroupID:  uint(rgid),
+		Name:        name,
+		Description: description,
+		Status:      fc.startTransition(id, "DEPLOYING", settled),
+		Cpu:         cpu,
+		Ram:         ram,
+		ImageID:     image_id,
+		ImageName:   fakeImageName,
+		BootDisk:    boot_disk,
+		Hostname:    name,
+		DataDisks: []client.DataDiskRecord{
+			{ID: uint(fc.newID()), Label: "boot", DiskType: "B", SizeMax: boot_disk, Status: "ASSIGNED"},
+		},
+		NICs: []client.NicRecord{
+			{NicType: "bridge", MacAddress: fmt.Sprintf("52:54:00:00:%02x:%02x", id / 256 % 256, id % 256),
+			 DeviceName: fmt.Sprintf("vm-%d-00a0", id), IPAddress: fmt.Sprintf("192.168.103.%d", id % 250 + 2)},
+		},
+		GuestLogins: []client.GuestLoginRecord{
+			{Login: "user", Password: fmt.Sprintf("secret-%d", id)},
+		},
+		CreateTime: uint64(time.Now().Unix()),
+	}
+	return id
+}
+
+//
+// HTTP handling
+//
+func (fc *fakeController) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		fc.fail(w, http.StatusBadRequest, "Cannot parse request parameters")
+		return
+	}
+
+	fc.mutex.Lock()
+	fc.calls[r.URL.Path] += 1
+	hanging := fc.hanging[r.URL.Path]
+	failure, failing := fc.failures[r.URL.Path]
+	if failing {
+		failure.calls_left -= 1
+		if failure.calls_left <= 0 {
+			delete(fc.failures, r.URL.Path)
+		}
+	}
+	fc.mutex.Unlock()
+	if failing {
+		fc.fail(w, failure.status, "Injected failure")
+		return
+	}
+	if hanging {
+		// wait until the client goes away, but do not block the test forever if it never does
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Minute):
+			fc.fail(w, http.StatusGatewayTimeout, "Request was not abandoned by the client")
+		}
+		return
+	}
+
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	switch r.URL.Path {
+	case "/v1/oauth/access_token":
+		fc.handleAccessToken(w, r)
+		return
+	case "/restmachine/cloudapi/users/authenticate":
+		fc.handleAuthenticate(w, r)
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, "/restmachine/") {
+		fc.fail(w, http.StatusNotFound, fmt.Sprintf("Unknown path %s", r.URL.Path))
+		return
+	}
+	if !fc.authorized(r) {
+		fc.fail(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	handler, ok := fc.apiHandlers()[r.URL.Path]
+	if !ok || fc.removed[r.URL.Path] {
+		fc.fail(w, http.StatusNotFound, fmt.Sprintf("Unknown API %s", r.URL.Path))
+		return
+	}
+	if text, ok := fc.plain_replies[r.URL.Path]; ok {
+		handler(httptest.NewRecorder(), r)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(text))
+		return
+	}
+	handler(w, r)
+}
+
+func (fc *fakeController) apiHandlers() map[string]func(http.ResponseWriter, *http.Request) {
+	return map[string]func(http.ResponseWriter, *http.Request){
+		client.APICatalogAPI:             fc.handleAPICatalog,
+		client.TenantsListAPI:            fc.handleAccountsList,
+		client.CloudspacesListAPI:        fc.handleCloudspacesList,
+		client.CloudspacesGetAPI:         fc.handleCloudspacesGet,
+		client.ResgroupCreateAPI:         fc.handleCloudspacesCreate,
+		client.CloudspacesUpdateAPI:      fc.handleCloudspacesUpdate,
+		client.CloudspacesDeleteAPI:      fc.handleCloudspacesDelete,
+		client.MachineCreateAPI:          fc.handleMachinesCreate,
+		client.MachinesGetAPI:            fc.handleMachinesGet,
+		client.MachinesListAPI:           fc.handleMachinesList,
+		client.MachineDeleteAPI:          fc.handleMachinesDelete,
+		client.MachineResizeAPI:          fc.handleMachinesResize,
+		client.MachineUpdateAPI:          fc.handleMachinesUpdate,
+		client.MachineStopAPI:            fc.handleMachinesStop,
+		client.MachineStartAPI:           fc.handleMachinesStart,
+		client.DiskAttachAPI:             fc.handleMachinesAttachDisk,
+		client.AttachExternalNetworkAPI:  fc.handleMachinesAttachExtNet,
+		client.DiskCreateAPI:             fc.handleDisksCreate,
+		client.DiskDetachAPI:             fc.handleMachinesDetachDisk,
+		client.DiskResizeAPI:             fc.handleDisksResize,
+		client.DiskDeleteAPI:             fc.handleDisksDelete,
+		client.PortforwardsListAPI:       fc.handlePortforwardingList,
+		client.PortforwardingCreateAPI:   fc.handlePortforwardingCreate,
+		client.PortforwardingDeleteAPI:   fc.handlePortforwardingDelete,
+		client.ImagesListAPI:             fc.handleImagesList,
+		client.AccountExtNetworksListAPI: fc.handleExtNetworksList,
+	}
+}
+
+func (fc *fakeController) handleAPICatalog(w http.ResponseWriter, r *http.Request) {
+	if fc.catalog_missing {
+		fc.fail(w, http.StatusNotFound, fmt.Sprintf("Unknown API %s", r.URL.Path))
+		return
+	}
+	catalog := client.APICatalogResp{
+		Info:     client.APICatalogInfo{Title: "Fake DECS cloudapi", Version: "fake-3.0"},
+		BasePath: "/restmachine",
+		Paths:    make(map[string]interface{}),
+	}
+	for api_name := range fc.apiHandlers() {
+		if !fc.removed[api_name] {
+			catalog.Paths[strings.TrimPrefix(api_name, "/restmachine")] = map[string]interface{}{"post": map[string]interface{}{}}
+		}
+	}
+	fc.reply(w, catalog)
+}
+
+func (fc *fakeController) authorized(r *http.Request) bool {
+	// Legacy mode passes session key as authkey parameter, jwt and oauth2 modes pass JWT in the header
+	if authkey := r.PostForm.Get("authkey"); authkey != "" {
+		if fc.sessions[authkey] {
+			fc.auth_kinds["session_key"] += 1
+			return true
+		}
+		return false
+	}
+	auth_header := r.Header.Get("Authorization")
+	if strings.HasPrefix(strings.ToLower(auth_header), "bearer ") && fc.tokens[auth_header[len("bearer "):]] && !fc.deny_tokens {
+		fc.auth_kinds["bearer"] += 1
+		return true
+	}
+	return false
+}
+
+func (fc *fakeController) handleAccessToken(w http.ResponseWriter, r *http.Request) {
+	if r.PostForm.Get("client_id") != fakeAppID || r.PostForm.Get("client_secret") != fakeAppSecret {
+		fc.fail(w, http.StatusUnauthorized, "Invalid client credentials")
+		return
+	}
+	validity, err := strconv.Atoi(r.PostForm.Get("validity"))
+	if err != nil || validity <= 0 {
+		validity = 3600
+	}
+	token := fc.newJWT(fakeAppID, time.Duration(validity) * time.Second)
+	fc.auth_kinds["access_token"] += 1
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(token))
+}
+
+func (fc *fakeController) handleAuthenticate(w http.ResponseWriter, r *http.Request) {
+	if r.PostForm.Get("username") != fakeLegacyUser || r.PostForm.Get("password") != fakeLegacyPassword {
+		fc.fail(w, http.StatusUnauthorized, "Invalid user name or password")
+		return
+	}
+	sid := fmt.Sprintf("fake-session-%d", fc.newID())
+	fc.sessions[sid] = true
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(sid))
+}
+
+func (fc *fakeController) handleAccountsList(w http.ResponseWriter, r *http.Request) {
+	fc.reply(w, fc.tenants)
+}
+
+func (fc *fakeController) tenantName(tenant_id int) string {
+	for _, tenant := range fc.tenants {
+		if tenant.ID == tenant_id {
+			return tenant.Name
+		}
+	}
+	return ""
+}
+
+func (fc *fakeController) handleCloudspacesList(w http.ResponseWriter, r *http.Request) {
+	result := client.CloudspacesListResp{}
+	for _, id := range sortedIDs(fc.cloudspaces) {
+		rg := fc.cloudspaces[id]
+		result = append(result, client.CloudspaceRecord{
+			ID:         rg.ID,
+			Name:       rg.Name,
+			Status:     rg.Status,
+			TenantID:   rg.TenantID,
+			TenantName: fc.tenantName(rg.TenantID),
+			GridID:     rg.GridID,
+			Location:   rg.Location,
+			ExtNetIP:   rg.ExtIP,
+			PublicIP:   rg.PublicIP,
+			CreateTime: rg.CreateTime,
+		})
+	}
+	fc.reply(w, result)
+}
+
+func (fc *fakeController) handleCloudspacesGet(w http.ResponseWriter, r *http.Request) {
+	rg, ok := fc.lookupCloudspace(w, r)
+	if ok {
+		fc.advanceTransition(int(rg.ID), &rg.Status)
+		fc.reply(w, rg)
+	}
+}
+
+func (fc *fakeController) handleCloudspacesCreate(w http.ResponseWriter, r *http.Request) {
+	tenant_id, ok := fc.intParam(w, r, "accountId")
+	if !ok {
+		return
+	}
+	if fc.tenantName(tenant_id) == "" {
+		fc.fail(w, http.StatusNotFound, fmt.Sprintf("Account with id %d not found", tenant_id))
+		return
+	}
+	for _, name := range []string{"name", "location", "access"} {
+		if r.PostForm.Get(name) == "" {
+			fc.fail(w, http.StatusBadRequest, fmt.Sprintf("Missing required argument %s", name))
+			return
+		}
+	}
+	quotas := client.QuotaRecord{
+		Cpu:        optionalInt(r, "maxCPUCapacity"),
+		Ram:        float32(optionalFloat(r, "maxMemoryCapacity")),
+		Disk:       optionalInt(r, "maxVDiskCapacity"),
+		NetTraffic: optionalInt(r, "maxNetworkPeerTransfer"),
+		ExtIPs:     optionalInt(r, "maxNumPublicIP"),
+	}
+	id := fc.createCloudspace(tenant_id, r.PostForm.Get("name"), r.PostForm.Get("location"), quotas)
+	fc.reply(w, id)
+}
+
+func (fc *fakeController) handleCloudspacesUpdate(w http.ResponseWriter, r *http.Request) {
+	rg, ok := fc.lookupCloudspace(w, r)
+	if !ok {
+		return
+	}
+	if name := r.PostForm.Get("name"); name != "" {
+		rg.Name = name
+	}
+	if r.PostForm.Get("maxCPUCapacity") != "" {
+		rg.Quotas.Cpu = optionalInt(r, "maxCPUCapacity")
+	}
+	if r.PostForm.Get("maxMemoryCapacity") != "" {
+		rg.Quotas.Ram = float32(optionalFloat(r, "maxMemoryCapacity"))
+	}
+	if r.PostForm.Get("maxVDiskCapacity") != "" {
+		rg.Quotas.Disk = optionalInt(r, "maxVDiskCapacity")
+	}
+	if r.PostForm.Get("maxNetworkPeerTransfer") != "" {
+		rg.Quotas.NetTraffic = optionalInt(r, "maxNetworkPeerTransfer")
+	}
+	if r.PostForm.Get("maxNumPublicIP") != "" {
+		rg.Quotas.ExtIPs = optionalInt(r, "maxNumPublicIP")
+	}
+	fc.reply(w, true)
+}
+
+func (fc *fakeController) handleCloudspacesDelete(w http.ResponseWriter, r *http.Request) {
+	rg, ok := fc.lookupCloudspace(w, r)
+	if !ok {
+		return
+	}
+	// VMs are destroyed together with their resource group
+	for id, vm := range fc.machines {
+		if vm.ResGroupID == rg.ID {
+			fc.deleteMachine(id)
+		}
+	}
+	delete(fc.cloudspaces, int(rg.ID))
+	fc.reply(w, true)
+}
+
+func (fc *fakeController) lookupCloudspace(w http.ResponseWriter, r *http.Request) (*client.CloudspacesGetResp, bool) {
+	id, ok := fc.intParam(w, r, "cloudspaceId")
+	if !ok {
+		return nil, false
+	}
+	rg, ok := fc.cloudspaces[id]
+	if !ok {
+		fc.fail(w, http.StatusNotFound, fmt.Sprintf("Cloudspace with id %d not found", id))
+		return nil, false
+	}
+	return rg, true
+}
+
+func (fc *fakeController) handleMachinesCreate(w http.ResponseWriter, r *http.Request) {
+	rgid, ok := fc.intParam(w, r, "cloudspaceId")
+	if !ok {
+		return
+	}
+	if _, ok := fc.cloudspaces[rgid]; !ok {
+		fc.fail(w, http.StatusNotFound, fmt.Sprintf("Cloudspace with id %d not found", rgid))
+		return
+	}
+	int_args := map[string]int{}
+	for _, name := range []string{"vcpus", "memory", "imageId", "disksize"} {
+		value, ok := fc.intParam(w, r, name)
+		if !ok {
+			return
+		}
+		int_args[name] = value
+	}
+	name := r.PostForm.Get("name")
+	if name == "" {
+		fc.fail(w, http.StatusBadRequest, "Missing required argument name")
+		return
+	}
+	for _, vm := range fc.machines {
+		if vm.Name == name && int(vm.ResGroupID) == rgid {
+			fc.fail(w, http.StatusConflict, fmt.Sprintf("Selected name %s already exists in this cloudspace", name))
+			return
+		}
+	}
+	id := fc.createMachine(rgid, name, r.PostForm.Get("description"), int_args["vcpus"], int_args["memory"],
+	                       int_args["imageId"], int_args["disksize"])
+	fc.reply(w, id)
+}
+
+func (fc *fakeController) handleMachinesGet(w http.ResponseWriter, r *http.Request) {
+	vm, ok := fc.lookupMachine(w, r)
+	if ok {
+		fc.advanceTransition(int(vm.ID), &vm.Status)
+		fc.reply(w, vm)
+	}
+}
+
+func (fc *fakeController) handleMachinesList(w http.ResponseWriter, r *http.Request) {
+	rgid, ok := fc.intParam(w, r, "cloudspaceId")
+	if !ok {
+		return
+	}
+	result := client.MachinesListResp{}
+	for _, id := range sortedIDs(fc.machines) {
+		vm := fc.machines[id]
+		if int(vm.ResGroupID) != rgid {
+			continue
+		}
+		record := client.MachineRecord{
+			ID:         vm.ID,
+			Name:       vm.Name,
+			Status:     vm.Status,
+			Cpu:        vm.Cpu,
+			Ram:        vm.Ram,
+			ImageID:    vm.ImageID,
+			BootDisk:   vm.BootDisk,
+			NICs:       vm.NICs,
+			CreateTime: vm.CreateTime,
+		}
+		for _, disk := range vm.DataDisks {
+			record.DataDisks = append(record.DataDisks, disk.ID)
+		}
+		result = append(result, record)
+	}
+	fc.reply(w, result)
+}
+
+func (fc *fakeController) handleMachinesDelete(w http.ResponseWriter, r *http.Request) {
+	vm, ok := fc.lookupMachine(w, r)
+	if !ok {
+		return
+	}
+	fc.deleteMachine(int(vm.ID))
+	fc.reply(w, true)
+}
+
+func (fc *fakeController) deleteMachine(id int) {
+	// data disks and port forwards of the VM are removed together with it
+	for _, disk := range fc.machines[id].DataDisks {
+		delete(fc.disks, int(disk.ID))
+	}
+	var rules []client.PortforwardRecord
+	for _, rule := range fc.portforwards {
+		if rule.VmID != id {
+			rules = append(rules, rule)
+		}
+	}
+	fc.portforwards = rules
+	delete(fc.machines, id)
+}
+
+func (fc *fakeController) handleMachinesResize(w http.ResponseWriter, r *http.Request) {
+	vm, ok := fc.lookupMachine(w, r)
+	if !ok {
+		return
+	}
+	if !fc.machineSettled(w, vm) {
+		return
+	}
+	cpu, ok := fc.intParam(w, r, "vcpus")
+	if !ok {
+		return
+	}
+	ram, ok := fc.intParam(w, r, "memory")
+	if !ok {
+		return
+	}
+	if fc.resize_needs_stop && vm.Status == "RUNNING" {
+		fc.fail(w, http.StatusConflict, fmt.Sprintf("Machine %d must be halted to resize", vm.ID))
+		return
+	}
+	vm.Cpu = cpu
+	vm.Ram = ram
+	fc.reply(w, true)
+}
+
+func (fc *fakeController) handleMachinesUpdate(w http.ResponseWriter, r *http.Request) {
+	vm, ok := fc.lookupMachine(w, r)
+	if !ok {
+		return
+	}
+	name := r.PostForm.Get("name")
+	if name == "" {
+		fc.fail(w, http.StatusBadRequest, "Missing required argument name")
+		return
+	}
+	for _, other := range fc.machines {
+		if other != vm && other.Name == name && other.ResGroupID == vm.ResGroupID {
+			fc.fail(w, http.StatusConflict, fmt.Sprintf("Selected name %s already exists in this cloudspace", name))
+			return
+		}
+	}
+	vm.Name = name
+	vm.Description = r.PostForm.Get("description")
+	fc.reply(w, true)
+}
+
+func (fc *fakeController) handleMachinesStop(w http.ResponseWriter, r *http.Request) {
+	vm, ok := fc.lookupMachine(w, r)
+	if ok && fc.machineSettled(w, vm) {
+		// like the real controller, stop VM in background - it is reported running until it actually stops
+		vm.Status = fc.transition(int(vm.ID), fc.power_gets, vm.Status, "HALTED")
+		fc.reply(w, true)
+	}
+}
+
+func (fc *fakeController) handleMachinesStart(w http.ResponseWriter, r *http.Request) {
+	vm, ok := fc.lookupMachine(w, r)
+	if ok && fc.machineSettled(w, vm) {
+		vm.Status = fc.transition(int(vm.ID), fc.power_gets, vm.Status, "RUNNING")
+		fc.reply(w, true)
+	}
+}
+
+func (fc *fakeController) handleMachinesAttachDisk(w http.ResponseWriter, r *http.Request) {
+	vm, ok := fc.lookupMachine(w, r)
+	if !ok {
+		return
+	}
+	if !fc.machineSettled(w, vm) {
+		return
+	}
+	disk_id, ok := fc.intParam(w, r, "diskId")
+	if !ok {
+		return
+	}
+	disk, ok := fc.disks[disk_id]
+	if !ok {
+		fc.fail(w, http.StatusNotFound, fmt.Sprintf("Disk with id %d not found", disk_id))
+		return
+	}
+	disk.Status = "ASSIGNED"
+	vm.DataDisks = append(vm.DataDisks, *disk)
+	fc.reply(w, true)
+}
+
+func (fc *fakeController) handleMachinesDetachDisk(w http.ResponseWriter, r *http.Request) {
+	vm, ok := fc.lookupMachine(w, r)
+	if !ok {
+		return
+	}
+	if !fc.machineSettled(w, vm) {
+		return
+	}
+	disk_id, ok := fc.intParam(w, r, "diskId")
+	if !ok {
+		return
+	}
+	var disks []client.DataDiskRecord
+	for _, disk := range vm.DataDisks {
+		if int(disk.ID) != disk_id {
+			disks = append(disks, disk)
+		}
+	}
+	if len(disks) == len(vm.DataDisks) {
+		fc.fail(w, http.StatusNotFound, fmt.Sprintf("Disk with id %d is not attached to machine %d", disk_id, vm.ID))
+		return
+	}
+	vm.DataDisks = disks
+	fc.disks[disk_id].Status = "CREATED"
+	fc.reply(w, true)
+}
+
+func (fc *fakeController) handleMachinesAttachExtNet(w http.ResponseWriter, r *http.Request) {
+	vm, ok := fc.lookupMachine(w, r)
+	if !ok {
+		return
+	}
+	if !fc.machineSettled(w, vm) {
+		return
+	}
+	net_id, ok := fc.intParam(w, r, "externalNetworkId")
+	if !ok {
+		return
+	}
+	for _, nic := range vm.NICs {
+		if nic.NicType == "PUBLIC" {
+			fc.fail(w, http.StatusConflict, "Machine is already connected to an external network")
+			return
+		}
+	}
+	vm.NICs = append(vm.NICs, client.NicRecord{
+		NicType:    "PUBLIC",
+		DeviceName: fmt.Sprintf("vm-%d-%d-ext", vm.ID, net_id),
+		MacAddress: fmt.Sprintf("52:54:00:01:%02x:%02x", vm.ID / 256 % 256, vm.ID % 256),
+		IPAddress:  fmt.Sprintf("10.1.0.%d/24", vm.ID % 250 + 2),
+		Params:     fmt.Sprintf("gateway:10.1.0.1 externalnetworkId:%d", net_id),
+	})
+	fc.reply(w, true)
+}
+
+func (fc *fakeController) lookupMachine(w http.ResponseWriter, r *http.Request) (*client.MachinesGetResp, bool) {
+	id, ok := fc.intParam(w, r, "machineId")
+	if !ok {
+		return nil, false
+	}
+	vm, ok := fc.machines[id]
+	if !ok {
+		fc.fail(w, http.StatusNotFound, fmt.Sprintf("Machine with id %d not found", id))
+		return nil, false
+	}
+	return vm, true
+}
+
+func (fc *fakeController) handleDisksCreate(w http.ResponseWriter, r *http.Request) {
+	int_args := map[string]int{}
+	for _, name := range []string{"accountId", "gid", "size"} {
+		value, ok := fc.intParam(w, r, name)
+		if !ok {
+			return
+		}
+		int_args[name] = value
+	}
+	id := fc.newID()
+	fc.disks[id] = &client.DataDiskRecord{
+		ID:          uint(id),
+		Label:       r.PostForm.Get("name"),
+		Description: r.PostForm.Get("description"),
+		DiskType:    r.PostForm.Get("type"),
+		SizeMax:     int_args["size"],
+		Status:      "CREATED",
+	}
+	fc.reply(w, id)
+}
+
+func (fc *fakeController) handleDisksResize(w http.ResponseWriter, r *http.Request) {
+	disk, ok := fc.lookupDisk(w, r)
+	if !ok {
+		return
+	}
+	size, ok := fc.intParam(w, r, "size")
+	if !ok {
+		return
+	}
+	if size < disk.SizeMax {
+		fc.fail(w, http.StatusBadRequest, fmt.Sprintf("Disk %d cannot be shrunk", disk.ID))
+		return
+	}
+	disk.SizeMax = size
+	// VMs hold copies of the records of their disks
+	for _, vm := range fc.machines {
+		for index := range vm.DataDisks {
+			if vm.DataDisks[index].ID == disk.ID {
+				vm.DataDisks[index].SizeMax = size
+			}
+		}
+	}
+	fc.reply(w, true)
+}
+
+func (fc *fakeController) handleDisksDelete(w http.ResponseWriter, r *http.Request) {
+	disk, ok := fc.lookupDisk(w, r)
+	if !ok {
+		return
+	}
+	if disk.Status == "ASSIGNED" {
+		fc.fail(w, http.StatusConflict, fmt.Sprintf("Disk %d is attached to a machine", disk.ID))
+		return
+	}
+	delete(fc.disks, int(disk.ID))
+	fc.reply(w, true)
+}
+
+func (fc *fakeController) lookupDisk(w http.ResponseWriter, r *http.Request) (*client.DataDiskRecord, bool) {
+	id, ok := fc.intParam(w, r, "diskId")
+	if !ok {
+		return nil, false
+	}
+	disk, ok := fc.disks[id]
+	if !ok {
+		fc.fail(w, http.StatusNotFound, fmt.Sprintf("Disk with id %d not found", id))
+		return nil, false
+	}
+	return disk, true
+}
+
+func (fc *fakeController) handlePortforwardingList(w http.ResponseWriter, r *http.Request) {
+	rgid, ok := fc.intParam(w, r, "cloudspaceId")
+	if !ok {
+		return
+	}
+	vm_id := optionalInt(r, "machineId")
+	result := client.PortforwardsResp{}
+	for _, rule := range fc.portforwards {
+		vm, ok := fc.machines[rule.VmID]
+		if !ok || int(vm.ResGroupID) != rgid || (vm_id != 0 && rule.VmID != vm_id) {
+			continue
+		}
+		if fc.upper_proto {
+			rule.Proto = strings.ToUpper(rule.Proto)
+		}
+		result = append(result, rule)
+	}
+	fc.reply(w, result)
+}
+
+func (fc *fakeController) handlePortforwardingCreate(w http.ResponseWriter, r *http.Request) {
+	vm, ok := fc.lookupMachine(w, r)
+	if !ok {
+		return
+	}
+	ext_port, ok := fc.intParam(w, r, "publicPort")
+	if !ok {
+		return
+	}
+	int_port, ok := fc.intParam(w, r, "localPort")
+	if !ok {
+		return
+	}
+	ext_ip := r.PostForm.Get("publicIp")
+	for _, rule := range fc.portforwards {
+		if rule.ExtIP == ext_ip && rule.ExtPort == strconv.Itoa(ext_port) && rule.Proto == r.PostForm.Get("protocol") {
+			fc.fail(w, http.StatusConflict, fmt.Sprintf("Forward to %s with port %d already exists", ext_ip, ext_port))
+			return
+		}
+	}
+	fc.portforwards = append(fc.portforwards, client.PortforwardRecord{
+		ID:      fc.newID(),
+		Proto:   r.PostForm.Get("protocol"),
+		ExtIP:   ext_ip,
+		ExtPort: strconv.Itoa(ext_port),
+		IntIP:   strings.Split(vm.NICs[0].IPAddress, "/")[0],
+		IntPort: strconv.Itoa(int_port),
+		VmID:    int(vm.ID),
+		VmName:  vm.Name,
+	})
+	fc.reply(w, true)
+}
+
+func (fc *fakeController) handlePortforwardingDelete(w http.ResponseWriter, r *http.Request) {
+	rg, ok := fc.lookupCloudspace(w, r)
+	if !ok {
+		return
+	}
+	id, ok := fc.intParam(w, r, "id")
+	if !ok {
+		return
+	}
+	for index, rule := range fc.portforwards {
+		vm, vm_ok := fc.machines[rule.VmID]
+		if rule.ID == id && vm_ok && vm.ResGroupID == rg.ID {
+			fc.portforwards = append(fc.portforwards[:index], fc.portforwards[index+1:]...)
+			fc.reply(w, true)
+			return
+		}
+	}
+	fc.fail(w, http.StatusNotFound, fmt.Sprintf("Port forward with id %d not found", id))
+}
+
+func (fc *fakeController) handleImagesList(w http.ResponseWriter, r *http.Request) {
+	fc.reply(w, fc.images)
+}
+
+func (fc *fakeController) handleExtNetworksList(w http.ResponseWriter, r *http.Request) {
+	fc.reply(w, fc.extnets)
+}
+
+//
+// request parsing and response formatting helpers
+//
+func (fc *fakeController) intParam(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	value, err := strconv.Atoi(r.PostForm.Get(name))
+	if err != nil {
+		fc.fail(w, http.StatusBadRequest, fmt.Sprintf("Argument %s must be an integer", name))
+		return 0, false
+	}
+	return value, true
+}
+
+func optionalInt(r *http.Request, name string) int {
+	value, err := strconv.Atoi(r.PostForm.Get(name))
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+func optionalFloat(r *http.Request, name string) float64 {
+	value, err := strconv.ParseFloat(r.PostForm.Get(name), 64)
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+func sortedIDs(objects interface{}) []int {
+	var ids []int
+	switch typed := objects.(type) {
+	case map[int]*client.CloudspacesGetResp:
+		for id := range typed {
+			ids = append(ids, id)
+		}
+	case map[int]*client.MachinesGetResp:
+		for id := range typed {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (fc *fakeController) reply(w http.ResponseWriter, value interface{}) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(pyReprOf(value)))
+}
+
+func (fc *fakeController) fail(w http.ResponseWriter, status_code int, message string) {
+	w.WriteHeader(status_code)
+	w.Write([]byte(pyRepr(message)))
+}
+
+func pyReprOf(value interface{}) string {
+	// Format value the way the real controller does, i.e. as Python literal. The value is
+	// converted to generic form through its JSON representation, so that json tags of the
+	// API structures define the field names.
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var generic interface{}
+	if err = decoder.Decode(&generic); err != nil {
+		panic(err)
+	}
+	return pyRepr(generic)
+}
+
+func pyRepr(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if typed {
+			return "True"
+		}
+		return "False"
+	case json.Number:
+		return typed.String()
+	case int:
+		return strconv.Itoa(typed)
+	case string:
+		escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`).Replace(typed)
+		return "u'" + escaped + "'"
+	case []interface{}:
+		items := make([]string, len(typed))
+		for index, item := range typed {
+			items[index] = pyRepr(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := make([]string, len(keys))
+		for index, key := range keys {
+			items[index] = pyRepr(key) + ": " + pyRepr(typed[key])
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	panic(fmt.Sprintf("pyRepr: unsupported type %T", value))
+}
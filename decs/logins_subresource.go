@@ -23,9 +23,11 @@ import (
 
 	"github.com/hashicorp/terraform/helper/schema"
 	// "github.com/hashicorp/terraform/helper/validation"
+
+	"github.com/terraform-provider-decs/decs/client"
 )
 
-func flattenGuestLogins(logins []GuestLoginRecord) []interface{} {
+func flattenGuestLogins(logins []client.GuestLoginRecord) []interface{} {
 	var result = make([]interface{}, len(logins))
 
 	elem := make(map[string]interface{})
@@ -23,6 +23,7 @@ type DiskConfig struct {
 	Pool string
 	Provider string
 	ID int
+	KeepOnRemove bool
 }
 
 type NetworkConfig struct {
@@ -19,12 +19,16 @@ package decs
 
 import (
 
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
 
+	"github.com/hashicorp/terraform/helper/hashcode"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
+
+	"github.com/terraform-provider-decs/decs/client"
 )
 
 func makeNetworksConfig(arg_list []interface{}) (nets []NetworkConfig, count int) {
@@ -45,7 +49,7 @@ func makeNetworksConfig(arg_list []interface{}) (nets []NetworkConfig, count int
 	return nets, count
 } 
 
-func flattenNetworks(nets []NicRecord) []interface{} {
+func flattenNetworks(nets []client.NicRecord) []interface{} {
 	// this function expects an array of NicRecord as returned by machines/get API call
 	// NOTE: it does NOT expect a strucutre as returned by externalnetwork/list
 	var length = 0
@@ -133,18 +137,19 @@ func makePortforwardsConfig(arg_list []interface{}) (pfws []PortforwardConfig, c
 		// pfws[index].Label = subres_data["label"].(string) - should be uncommented for future release
 		pfws[index].ExtPort = subres_data["ext_port"].(int)
 		pfws[index].IntPort = subres_data["int_port"].(int)
-		pfws[index].Proto = subres_data["proto"].(string)
+		// configuration value is passed here as is, StateFunc only affects what is kept in the state
+		pfws[index].Proto = strings.ToLower(subres_data["proto"].(string))
 	}
 
 	return pfws, count
 }
 
-func flattenPortforwards(pfws []PortforwardRecord) []interface{} {
+func flattenPortforwards(pfws []client.PortforwardRecord) []interface{} {
 	result := make([]interface{}, len(pfws))
-	elem := make(map[string]interface{})
 	var port_num int
 
 	for index, value := range pfws {
+		elem := make(map[string]interface{})
 		// elem["label"] = ... - should be uncommented for the future release
 
 		// external port field is of TypeInt in the portforwardSubresourceSchema, but string is returned
@@ -155,7 +160,8 @@ func flattenPortforwards(pfws []PortforwardRecord) []interface{} {
 		// by portforwards/list API, so we need conversion here
 		port_num, _ = strconv.Atoi(value.IntPort)
 		elem["int_port"] = port_num
-		elem["proto"] = value.Proto
+		// controller may report protocol in upper case, while proto is kept in lower case in the state
+		elem["proto"] = strings.ToLower(value.Proto)
 		elem["ext_ip"] = value.ExtIP
 		elem["int_ip"] = value.IntIP
 		result[index] = elem
@@ -164,6 +170,16 @@ func flattenPortforwards(pfws []PortforwardRecord) []interface{} {
 	return result 
 }
 
+func portforwardKey(ext_port int, int_port int, proto string) string {
+	// Port forwarding rule is identified by its ports and protocol, addresses are assigned by the controller
+	return fmt.Sprintf("%d:%d/%s", ext_port, int_port, strings.ToLower(proto))
+}
+
+func portforwardHash(value interface{}) int {
+	elem := value.(map[string]interface{})
+	return hashcode.String(portforwardKey(elem["ext_port"].(int), elem["int_port"].(int), elem["proto"].(string)))
+}
+
 func portforwardSubresourceSchema() map[string]*schema.Schema {
 	rets := map[string]*schema.Schema {
 		/* this should be uncommented for the future release
@@ -189,10 +205,11 @@ func portforwardSubresourceSchema() map[string]*schema.Schema {
 		},
 
 		"proto": {
-			Type:        schema.TypeString,
-			Required:    true,
-			// ValidateFunc: validation.IntBetween(1, ),
-			Description: "Protocol type for this port forwarding rule. Should be either 'tcp' or 'udp'.",
+			Type:         schema.TypeString,
+			Required:     true,
+			StateFunc:    stateFuncToLower,
+			ValidateFunc: validation.StringInSlice([]string{"tcp", "udp"}, true), // ignore case while validating
+			Description:  "Protocol type for this port forwarding rule. Should be either 'tcp' or 'udp'.",
 		},
 
 		"ext_ip": {
@@ -211,7 +228,7 @@ func portforwardSubresourceSchema() map[string]*schema.Schema {
 	return rets
 }
 
-func flattenNICs(nics []NicRecord) []interface{} {
+func flattenNICs(nics []client.NicRecord) []interface{} {
 	var result = make([]interface{}, len(nics))
 	elem := make(map[string]interface{})
 
@@ -0,0 +1,264 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+
+)
+
+// DECS config file holds named profiles with provider arguments in INI-like format:
+//
+//   [default]
+//   authenticator = oauth2
+//   controller_url = https://ctrl.example.com
+//   oauth2_url = https://sso.example.com
+//
+//   [profile staging]
+//   authenticator = legacy
+//   controller_url = https://ctrl-staging.example.com
+//
+// Section header may be either "[name]" or "[profile name]". Only the arguments that define how to
+// connect and authenticate to the controller can be set in a profile. Arguments that tune provider
+// behaviour, such as retries, request limits, caching and recording, must be set in the provider block
+// or by their environment variables.
+
+// environment variable that overrides the default location of the DECS config file
+const ConfigFileEnvVar = "DECS_CONFIG_FILE"
+
+// profile which is used when no profile is explicitly selected
+const DefaultProfileName = "default"
+
+// provider arguments that can be set in a profile and their types
+var profileArgs = map[string]schema.ValueType{
+	"authenticator":        schema.TypeString,
+	"controller_url":       schema.TypeString,
+	"controller_urls":      schema.TypeList, // comma separated list
+	"oauth2_url":           schema.TypeString,
+	"user":                 schema.TypeString,
+	"password":             schema.TypeString,
+	"app_id":               schema.TypeString,
+	"app_secret":           schema.TypeString,
+	"jwt":                  schema.TypeString,
+	"jwt_file":             schema.TypeString,
+	"jwt_validity":         schema.TypeInt,
+	"credential_process":   schema.TypeString,
+	"allow_unverified_ssl": schema.TypeBool,
+	"ca_file":              schema.TypeString,
+	"ca_pem":               schema.TypeString,
+	"client_cert":          schema.TypeString,
+	"client_key":           schema.TypeString,
+	"tls_min_version":      schema.TypeString,
+}
+
+func defaultConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".decs", "config")
+}
+
+func checkProfileValue(key string, value string) error {
+	// Check that the value from DECS config file can be converted to the type of the argument
+	switch profileArgs[key] {
+	case schema.TypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("setting %q must be true or false", key)
+		}
+	case schema.TypeInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("setting %q must be an integer", key)
+		}
+	}
+	return nil
+}
+
+func readProfiles(file_name string) (map[string]map[string]string, error) {
+	// Parse DECS config file and return profile settings indexed by profile name.
+	file, err := os.Open(file_name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	profiles := make(map[string]map[string]string)
+	var current map[string]string
+	line_num := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line_num += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1:len(line)-1])
+			name = strings.TrimSpace(strings.TrimPrefix(name, "profile "))
+			if name == "" {
+				return nil, fmt.Errorf("%s:%d: empty profile name.", file_name, line_num)
+			}
+			current = make(map[string]string)
+			profiles[name] = current
+			continue
+		}
+
+		pos := strings.Index(line, "=")
+		if pos < 0 {
+			return nil, fmt.Errorf("%s:%d: expected 'key = value' line.", file_name, line_num)
+		}
+		if current == nil {
+			return nil, fmt.Errorf("%s:%d: setting outside of a profile section.", file_name, line_num)
+		}
+		key := strings.TrimSpace(line[:pos])
+		if _, ok := profileArgs[key]; !ok {
+			return nil, fmt.Errorf("%s:%d: unknown setting %q.", file_name, line_num, key)
+		}
+		value := strings.TrimSpace(line[pos+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1:len(value)-1]
+		}
+		if err = checkProfileValue(key, value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s.", file_name, line_num, err)
+		}
+		current[key] = value
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+func loadProfile(profile_name string) (map[string]string, error) {
+	// Load settings of the named profile from DECS config file. If no profile name is given, the
+	// default profile is loaded if it exists. Explicitly selected profile must exist.
+	file_name := os.Getenv(ConfigFileEnvVar)
+	if file_name == "" {
+		file_name = defaultConfigFile()
+	}
+
+	explicit := profile_name != ""
+	if !explicit {
+		profile_name = DefaultProfileName
+	}
+
+	profiles, err := readProfiles(file_name)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to read DECS config file: %s", err)
+	}
+
+	profile, ok := profiles[profile_name]
+	if !ok {
+		if explicit {
+			return nil, fmt.Errorf("Profile %q not found in DECS config file %q.", profile_name, file_name)
+		}
+		return nil, nil
+	}
+
+	log.Printf("loadProfile: using profile %q from DECS config file %q", profile_name, file_name)
+	return profile, nil
+}
+
+// providerArgs gives access to provider arguments with the values from the selected profile
+// used for arguments that are not set explicitly (in the configuration or by environment variables).
+// Arguments that can be set in a profile must have no default value in the schema, so that it is
+// possible to tell whether they are set. Their defaults are applied by the code that uses them.
+type providerArgs struct {
+	d *schema.ResourceData
+	profile map[string]string
+}
+
+func newProviderArgs(d *schema.ResourceData) (*providerArgs, error) {
+	profile, err := loadProfile(d.Get("profile").(string))
+	if err != nil {
+		return nil, err
+	}
+	return &providerArgs{d: d, profile: profile}, nil
+}
+
+func (args *providerArgs) getString(name string) string {
+	value := args.d.Get(name).(string)
+	if value == "" && args.profile != nil {
+		value = args.profile[name]
+	}
+	return value
+}
+
+func (args *providerArgs) getStringList(name string, env_var string) []string {
+	// List arguments cannot have default value in the schema, so the environment variable and the
+	// profile setting, both holding comma separated list, are checked here.
+	var values []string
+	for _, item := range args.d.Get(name).([]interface{}) {
+		values = append(values, item.(string))
+	}
+	if len(values) > 0 {
+		return values
+	}
+	value := os.Getenv(env_var)
+	if value == "" && args.profile != nil {
+		value = args.profile[name]
+	}
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func (args *providerArgs) profileValue(name string) (string, bool) {
+	// Return the value of the argument from the profile unless the argument is set explicitly.
+	// Unlike strings, explicitly set false and 0 must override the profile too.
+	if args.profile == nil {
+		return "", false
+	}
+	if _, ok := args.d.GetOkExists(name); ok {
+		return "", false
+	}
+	value, ok := args.profile[name]
+	return value, ok
+}
+
+func (args *providerArgs) getBool(name string) bool {
+	if value, ok := args.profileValue(name); ok {
+		// values in the profile were checked when the config file was read
+		bool_value, _ := strconv.ParseBool(value)
+		return bool_value
+	}
+	return args.d.Get(name).(bool)
+}
+
+func (args *providerArgs) getInt(name string) int {
+	if value, ok := args.profileValue(name); ok {
+		int_value, _ := strconv.Atoi(value)
+		return int_value
+	}
+	return args.d.Get(name).(int)
+}
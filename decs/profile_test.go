@@ -0,0 +1,210 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const testProfilesConfig = `
+# profiles for provider argument merge tests
+[default]
+authenticator = legacy
+controller_url = https://default.example.com
+
+[profile staging]
+authenticator = oauth2
+controller_url = "https://staging.example.com"
+controller_urls = https://node1.example.com,https://node2.example.com
+oauth2_url = https://sso.example.com
+jwt_validity = 600
+allow_unverified_ssl = true
+tls_min_version = 1.3
+`
+
+func testSetEnv(env map[string]string) func() {
+	// Set environment variables and return function that restores their previous values
+	type saved_var struct {
+		value string
+		set bool
+	}
+	saved := make(map[string]saved_var)
+	for name, value := range env {
+		old_value, set := os.LookupEnv(name)
+		saved[name] = saved_var{old_value, set}
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, old := range saved {
+			if old.set {
+				os.Setenv(name, old.value)
+			} else {
+				os.Unsetenv(name)
+			}
+		}
+	}
+}
+
+func testProviderArgs(t *testing.T, raw map[string]interface{}) (*providerArgs, error) {
+	d := schema.TestResourceDataRaw(t, Provider().Schema, raw)
+	return newProviderArgs(d)
+}
+
+func TestProviderArgsMergeOrder(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+	config_file := filepath.Join(dir, "config")
+	testWriteFile(t, config_file, testProfilesConfig, 0600)
+	defer testSetEnv(map[string]string{ConfigFileEnvVar: config_file})()
+
+	cases := []struct {
+		name string
+		raw map[string]interface{}
+		env map[string]string
+		arg string
+		expected string
+	}{
+		{"default profile", nil, nil, "controller_url", "https://default.example.com"},
+		{"selected profile", map[string]interface{}{"profile": "staging"}, nil, "controller_url", "https://staging.example.com"},
+		{"profile from env", nil, map[string]string{"DECS_PROFILE": "staging"}, "authenticator", "oauth2"},
+		{"argument overrides profile", map[string]interface{}{"controller_url": "https://arg.example.com"}, nil,
+		 "controller_url", "https://arg.example.com"},
+		{"env overrides profile", nil, map[string]string{"DECS_CONTROLLER_URL": "https://env.example.com"},
+		 "controller_url", "https://env.example.com"},
+		{"argument overrides env", map[string]interface{}{"controller_url": "https://arg.example.com"},
+		 map[string]string{"DECS_CONTROLLER_URL": "https://env.example.com"}, "controller_url", "https://arg.example.com"},
+		{"not in profile", nil, nil, "oauth2_url", ""},
+		{"list from profile", map[string]interface{}{"profile": "staging"}, nil,
+		 "controller_urls", "https://node1.example.com,https://node2.example.com"},
+		{"list from env", map[string]interface{}{"profile": "staging"}, map[string]string{"DECS_CONTROLLER_URLS": "https://env.example.com"},
+		 "controller_urls", "https://env.example.com"},
+		{"list argument", map[string]interface{}{"profile": "staging", "controller_urls": []interface{}{"https://arg.example.com"}}, nil,
+		 "controller_urls", "https://arg.example.com"},
+		{"int from profile", map[string]interface{}{"profile": "staging"}, nil, "jwt_validity", "600"},
+		{"int argument", map[string]interface{}{"profile": "staging", "jwt_validity": 900}, nil, "jwt_validity", "900"},
+		{"int from env", map[string]interface{}{"profile": "staging"}, map[string]string{"DECS_JWT_VALIDITY": "1200"}, "jwt_validity", "1200"},
+		{"int not set", nil, nil, "jwt_validity", "0"},
+		{"bool from profile", map[string]interface{}{"profile": "staging"}, nil, "allow_unverified_ssl", "true"},
+		{"false argument overrides profile", map[string]interface{}{"profile": "staging", "allow_unverified_ssl": false}, nil,
+		 "allow_unverified_ssl", "false"},
+		{"false env overrides profile", map[string]interface{}{"profile": "staging"}, map[string]string{"DECS_ALLOW_UNVERIFIED_SSL": "false"},
+		 "allow_unverified_ssl", "false"},
+		{"TLS version from profile", map[string]interface{}{"profile": "staging"}, nil, "tls_min_version", "1.3"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer testSetEnv(tc.env)()
+			args, err := testProviderArgs(t, tc.raw)
+			if err != nil {
+				t.Fatalf("Failed to read provider arguments: %s", err)
+			}
+			var value string
+			switch profileArgs[tc.arg] {
+			case schema.TypeList:
+				value = strings.Join(args.getStringList(tc.arg, "DECS_CONTROLLER_URLS"), ",")
+			case schema.TypeInt:
+				value = fmt.Sprintf("%d", args.getInt(tc.arg))
+			case schema.TypeBool:
+				value = fmt.Sprintf("%t", args.getBool(tc.arg))
+			default:
+				value = args.getString(tc.arg)
+			}
+			if value != tc.expected {
+				t.Errorf("Argument %q is %q, expected %q", tc.arg, value, tc.expected)
+			}
+		})
+	}
+}
+
+func TestProviderArgsProfileErrors(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+	config_file := filepath.Join(dir, "config")
+	defer testSetEnv(map[string]string{ConfigFileEnvVar: config_file})()
+
+	cases := []struct {
+		name string
+		content string
+		profile string
+		expect_error string
+	}{
+		{"missing file", "", "staging", "Failed to read DECS config file"},
+		{"missing profile", "[default]\nuser = u\n", "staging", `Profile "staging" not found`},
+		{"unknown setting", "[default]\nmax_retries = 3\n", "", `config:2: unknown setting "max_retries"`},
+		{"bad bool", "[default]\nallow_unverified_ssl = maybe\n", "", `config:2: setting "allow_unverified_ssl" must be true or false`},
+		{"bad int", "[default]\njwt_validity = hour\n", "", `config:2: setting "jwt_validity" must be an integer`},
+		{"outside section", "user = u\n", "", `config:1: setting outside of a profile section`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(config_file)
+			if tc.content != "" {
+				testWriteFile(t, config_file, tc.content, 0600)
+			}
+			_, err := testProviderArgs(t, map[string]interface{}{"profile": tc.profile})
+			if err == nil || !regexp.MustCompile(tc.expect_error).MatchString(err.Error()) {
+				t.Errorf("Expected error matching %q, got %v", tc.expect_error, err)
+			}
+		})
+	}
+
+	// no default profile and no config file at all is fine
+	os.Remove(config_file)
+	if _, err := testProviderArgs(t, nil); err != nil {
+		t.Errorf("Missing DECS config file without explicit profile is reported: %s", err)
+	}
+}
+
+func TestControllerConfigureProfileDefaults(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+	config_file := filepath.Join(dir, "config")
+	testWriteFile(t, config_file, "[default]\nauthenticator = legacy\ncontroller_url = https://default.example.com\n" +
+	              "user = u\npassword = p\njwt_validity = 30\n", 0600)
+	defer testSetEnv(map[string]string{ConfigFileEnvVar: config_file})()
+
+	// value from the profile is checked like the one set in the provider block
+	_, err := ControllerConfigure(schema.TestResourceDataRaw(t, Provider().Schema, nil))
+	if err == nil || !strings.Contains(err.Error(), "jwt_validity must be at least 60 seconds") {
+		t.Errorf("Expected error on too short jwt_validity from profile, got %v", err)
+	}
+
+	// defaults are applied to arguments set neither explicitly nor in the profile
+	testWriteFile(t, config_file, "[default]\nauthenticator = legacy\ncontroller_url = https://default.example.com\n" +
+	              "user = u\npassword = p\n", 0600)
+	config, err := ControllerConfigure(schema.TestResourceDataRaw(t, Provider().Schema, nil))
+	if err != nil {
+		t.Fatalf("ControllerConfigure failed: %s", err)
+	}
+	if config.jwt_validity != defaultJWTValidity {
+		t.Errorf("JWT validity is %d, expected default %d", config.jwt_validity, defaultJWTValidity)
+	}
+	if config.cc_client.Transport.(*http.Transport).TLSClientConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Minimum TLS version is not 1.2 by default")
+	}
+}
@@ -30,11 +30,19 @@ import (
 var decsController *ControllerCfg
 
 func Provider() *schema.Provider {
-	return &schema.Provider {
+	provider := &schema.Provider {
 		Schema: map[string]*schema.Schema {
+			"profile": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_PROFILE", nil),
+				Description: "Name of the profile in DECS config file (~/.decs/config or the file set by DECS_CONFIG_FILE environment variable) to take provider arguments from. Arguments set explicitly override profile values.",
+			},
+
 			"authenticator": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_AUTHENTICATOR", nil),
 				StateFunc:   stateFuncToLower,
 				ValidateFunc: validation.StringInSlice([]string{"oauth2", "legacy", "jwt"}, true), // ignore case while validating
 				Description: "Authentication mode to use when connecting to DECS cloud API. Should be one of 'oauth2', 'legacy' or 'jwt'.",
@@ -50,12 +58,21 @@ func Provider() *schema.Provider {
 
 			"controller_url": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_CONTROLLER_URL", nil),
 				ForceNew:    true,
 				StateFunc:   stateFuncToLower,
 				Description: "The URL of DECS Cloud controller to use. API calls will be directed to this URL.",
 			},
 
+			"controller_urls": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The URLs of DECS Cloud controller nodes. API calls fail over to the next node if the current one fails. " +
+				             "May also be set by DECS_CONTROLLER_URLS environment variable as comma separated list.",
+			},
+
 			"user": {
 				Type:        schema.TypeString,
 				Optional:    true,
@@ -67,6 +84,7 @@ func Provider() *schema.Provider {
 				Type:        schema.TypeString,
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("DECS_PASSWORD", nil),
+				Sensitive:   true,
 				Description: "The user password for DECS cloud API operations in 'legacy' authentication mode.",
 			},
 
@@ -81,6 +99,7 @@ func Provider() *schema.Provider {
 				Type:        schema.TypeString,
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("DECS_APP_SECRET", nil),
+				Sensitive:   true,
 				Description: "Application secret to access DECS cloud API in 'oauth2' authentication mode.",
 			},
 
@@ -88,14 +107,129 @@ func Provider() *schema.Provider {
 				Type:        schema.TypeString,
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("DECS_JWT", nil),
+				Sensitive:   true,
 				Description: "JWT to access DECS cloud API in 'jwt' authentication mode.",
 			},
 
+			"jwt_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_JWT_FILE", nil),
+				Description: "Path to the file with JWT to access DECS cloud API in 'jwt' authentication mode. The file is re-read every time the JWT needs to be refreshed.",
+			},
+
+			"credential_process": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_CREDENTIAL_PROCESS", nil),
+				Description: "External command that prints to its stdout a JSON object with either 'jwt' (for 'jwt' authentication mode) or 'app_id' and 'app_secret' (for 'oauth2' mode).",
+			},
+
+			"jwt_validity": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("DECS_JWT_VALIDITY", nil),
+				ValidateFunc: validation.IntAtLeast(minJWTValidity),
+				Description:  "Validity period in seconds to request for JWT in 'oauth2' authentication mode, 3600 by default. JWT is refreshed automatically before it expires.",
+			},
+
+			"max_retries": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("DECS_MAX_RETRIES", 5),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Maximum number of times to repeat API call that failed due to transient controller or network error. Set to 0 to disable retries.",
+			},
+
+			"max_backoff": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("DECS_MAX_BACKOFF", 30),
+				ValidateFunc: validation.IntAtLeast(1),
+				Description:  "Maximum delay in seconds between repeated API calls. Actual delay grows exponentially up to this limit.",
+			},
+
+			"max_concurrent_requests": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("DECS_MAX_CONCURRENT_REQUESTS", 0),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Maximum number of API requests to run against DECS controller at the same time. Set to 0 for no limit.",
+			},
+
+			"requests_per_second": {
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("DECS_REQUESTS_PER_SECOND", 0.0),
+				ValidateFunc: validation.FloatBetween(0, 1000),
+				Description:  "Maximum rate of API requests per second to DECS controller. Set to 0 for no limit.",
+			},
+
+			"disable_cache": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_DISABLE_CACHE", false),
+				Description: "If set, responses of DECS list APIs are not cached and every lookup queries the controller.",
+			},
+
+			"recording_mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("DECS_RECORDING_MODE", nil),
+				ValidateFunc: validation.StringInSlice(recordingModes(), false),
+				Description:  "Set to 'record' to save all DECS API calls and responses to recording_file with secrets redacted, or to 'replay' to serve API responses from recording_file without connecting to DECS controller.",
+			},
+
+			"recording_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_RECORDING_FILE", nil),
+				Description: "Path to the file to record DECS API traffic to or to replay it from, see recording_mode. Recording is appended to the existing file.",
+			},
+
 			"allow_unverified_ssl": {
 				Type:        schema.TypeBool,
 				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_ALLOW_UNVERIFIED_SSL", nil),
 				Description: "If set, DECS API will allow unverifiable SSL certificates.",
 			},
+
+			"ca_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_CA_FILE", nil),
+				Description: "Path to the file with PEM encoded CA certificates to trust in addition to the system ones when connecting to DECS controller and Oauth2 provider.",
+			},
+
+			"ca_pem": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_CA_PEM", nil),
+				Description: "PEM encoded CA certificates to trust in addition to the system ones when connecting to DECS controller and Oauth2 provider.",
+			},
+
+			"client_cert": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_CLIENT_CERT", nil),
+				Description: "PEM encoded client certificate or path to the file with it for mutual TLS authentication.",
+			},
+
+			"client_key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("DECS_CLIENT_KEY", nil),
+				Sensitive:   true,
+				Description: "PEM encoded private key of the client certificate or path to the file with it for mutual TLS authentication.",
+			},
+
+			"tls_min_version": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("DECS_TLS_MIN_VERSION", nil),
+				ValidateFunc: validation.StringInSlice(tlsVersionNames(), false),
+				Description:  "Minimum TLS version to accept when connecting to DECS controller and Oauth2 provider. Should be one of '1.0', '1.1', '1.2' or '1.3', default is '1.2'.",
+			},
 		},
 		
 		ResourcesMap: map[string]*schema.Resource {
@@ -108,19 +242,24 @@ func Provider() *schema.Provider {
 			"decs_vm": dataSourceVm(),
 			"decs_image": dataSourceImage(),
 		},
-		
-		ConfigureFunc: providerConfigure,
 	}
+	provider.ConfigureFunc = func(d *schema.ResourceData) (interface{}, error) {
+		return providerConfigure(d, provider)
+	}
+	return provider
 }
 
 func stateFuncToLower(argval interface{}) string {
 	return strings.ToLower(argval.(string))
 }
 
-func providerConfigure(d *schema.ResourceData) (interface{}, error) {
+func providerConfigure(d *schema.ResourceData, provider *schema.Provider) (interface{}, error) {
 	decsController, err := ControllerConfigure(d)
 	if err != nil {
 		return nil, err
 	}
+	// operations in progress are abandoned when Terraform is interrupted
+	decsController.stop_ctx = provider.StopContext()
+	logAPISummaryOnStop(decsController.stop_ctx)
 	return decsController, nil
 }
\ No newline at end of file
@@ -0,0 +1,327 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+
+	"github.com/terraform-provider-decs/decs/client"
+)
+
+func TestProvider(t *testing.T) {
+	if err := Provider().InternalValidate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func testAccProviders() map[string]terraform.ResourceProvider {
+	return map[string]terraform.ResourceProvider{
+		"decs": Provider(),
+	}
+}
+
+func testAccProviderConfigLegacy(fc *fakeController) string {
+	return fmt.Sprintf(`
+provider "decs" {
+  authenticator  = "legacy"
+  controller_url = %q
+  user           = %q
+  password       = %q
+  max_retries    = 0
+}
+`, fc.URL(), fakeLegacyUser, fakeLegacyPassword)
+}
+
+func testAccProviderConfigOAuth2(fc *fakeController) string {
+	return fmt.Sprintf(`
+provider "decs" {
+  authenticator  = "oauth2"
+  controller_url = %q
+  oauth2_url     = %q
+  app_id         = %q
+  app_secret     = %q
+  max_retries    = 0
+}
+`, fc.URL(), fc.URL(), fakeAppID, fakeAppSecret)
+}
+
+func testAccProviderConfigJWT(fc *fakeController, token string) string {
+	return fmt.Sprintf(`
+provider "decs" {
+  authenticator  = "jwt"
+  controller_url = %q
+  oauth2_url     = %q
+  jwt            = %q
+  max_retries    = 0
+}
+`, fc.URL(), fc.URL(), token)
+}
+
+func testAccCheckFakeCalled(fc *fakeController, kind string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if fc.authCount(kind) == 0 {
+			return fmt.Errorf("No requests authenticated by %s reached fake DECS controller.", kind)
+		}
+		return nil
+	}
+}
+
+const testAccImageDataSourceConfig = `
+data "decs_image" "os" {
+  name = %q
+}
+`
+
+func TestAccProviderAuthenticators(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+
+	cases := []struct {
+		name string
+		config string
+		auth_kind string
+	}{
+		{"legacy", testAccProviderConfigLegacy(fc), "session_key"},
+		{"oauth2", testAccProviderConfigOAuth2(fc), "access_token"},
+		{"jwt", testAccProviderConfigJWT(fc, fc.issueJWT(fakeLegacyUser, time.Hour)), "bearer"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resource.UnitTest(t, resource.TestCase{
+				Providers: testAccProviders(),
+				Steps: []resource.TestStep{
+					{
+						Config: tc.config + fmt.Sprintf(testAccImageDataSourceConfig, fakeImageName),
+						Check: resource.ComposeTestCheckFunc(
+							resource.TestCheckResourceAttr("data.decs_image.os", "id", fmt.Sprintf("%d", fakeImageID)),
+							testAccCheckFakeCalled(fc, tc.auth_kind),
+						),
+					},
+				},
+			})
+		})
+	}
+}
+
+func TestAccProviderWrongCredentials(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := fmt.Sprintf(`
+provider "decs" {
+  authenticator  = "legacy"
+  controller_url = %q
+  user           = %q
+  password       = "wrong-password"
+  max_retries    = 0
+}
+`, fc.URL(), fakeLegacyUser)
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders(),
+		Steps: []resource.TestStep{
+			{
+				Config:      config + fmt.Sprintf(testAccImageDataSourceConfig, fakeImageName),
+				ExpectError: regexp.MustCompile("unexpected status code 401"),
+			},
+		},
+	})
+
+	if fc.callCount(client.ImagesListAPI) != 0 {
+		t.Errorf("API %q was called with invalid credentials", client.ImagesListAPI)
+	}
+}
+
+func testAccProviderConfigNodes(fc *fakeController, node_urls ...string) string {
+	return fmt.Sprintf(`
+provider "decs" {
+  authenticator   = "legacy"
+  controller_urls = ["%s"]
+  user            = %q
+  password        = %q
+  max_retries     = 0
+}
+`, strings.Join(node_urls, `", "`), fakeLegacyUser, fakeLegacyPassword)
+}
+
+// failingNode is a controller node that authenticates users through the fake controller, but fails
+// all other requests with the given status code, as the node with broken backend would do
+type failingNode struct {
+	server *httptest.Server
+	mutex sync.Mutex
+	logins int
+}
+
+func newFailingNode(fc *fakeController, status int) *failingNode {
+	node := &failingNode{}
+	node.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/restmachine/cloudapi/users/authenticate" {
+			node.mutex.Lock()
+			node.logins += 1
+			node.mutex.Unlock()
+			fc.serveHTTP(w, r)
+			return
+		}
+		http.Error(w, "Backend is not available", status)
+	}))
+	return node
+}
+
+func (node *failingNode) loginCount() int {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+	return node.logins
+}
+
+func TestAccProviderFailover(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+
+	failing := newFailingNode(fc, http.StatusServiceUnavailable)
+	defer failing.server.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead_url := dead.URL
+	dead.Close()
+
+	cases := []struct {
+		name string
+		first_url string
+		node *failingNode
+	}{
+		{"connection refused", dead_url, nil},
+		{"server error", failing.server.URL, failing},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logins_before := fc.callCount("/restmachine/cloudapi/users/authenticate")
+			resource.UnitTest(t, resource.TestCase{
+				Providers:    testAccProviders(),
+				CheckDestroy: testAccCheckFakeEmpty(fc),
+				Steps: []resource.TestStep{
+					{
+						Config: testAccProviderConfigNodes(fc, tc.first_url, fc.URL()) +
+						        fmt.Sprintf(testAccResgroupConfig, fakeTenantName, 4),
+						Check: resource.ComposeTestCheckFunc(
+							resource.TestCheckResourceAttrSet("decs_resgroup.rg", "id"),
+							testAccCheckResgroupQuota(fc, "tf-acc-rg", 4),
+						),
+					},
+				},
+			})
+			if tc.node == nil {
+				return
+			}
+
+			// session key obtained from the failing node must be used on the healthy one without logging in again
+			logins := fc.callCount("/restmachine/cloudapi/users/authenticate") - logins_before
+			if tc.node.loginCount() == 0 {
+				t.Fatalf("Provider did not log in through the first controller node.")
+			}
+			if logins != tc.node.loginCount() {
+				t.Errorf("Provider logged in %d times, %d of them through the first controller node.", logins, tc.node.loginCount())
+			}
+		})
+	}
+}
+
+func TestFailoverOnlyOnNodeFailure(t *testing.T) {
+	cases := []struct {
+		name string
+		status int
+		api_name string
+		switched bool
+	}{
+		{"unavailable node, read", http.StatusServiceUnavailable, client.ImagesListAPI, true},
+		{"gateway timeout, read", http.StatusGatewayTimeout, client.ImagesListAPI, true},
+		// healthy node may reply with 500 to a request it cannot process
+		{"server error, read", http.StatusInternalServerError, client.ImagesListAPI, false},
+		// the failed node may have carried out the call, so it must not be repeated on another node
+		{"unavailable node, change", http.StatusServiceUnavailable, client.MachineStopAPI, false},
+		{"bad gateway, change", http.StatusBadGateway, client.MachineStopAPI, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := newFakeController()
+			defer fc.Close()
+			failing := newFailingNode(fc, tc.status)
+			defer failing.server.Close()
+			config := testControllerConfig(t, map[string]interface{}{
+				"authenticator":   "legacy",
+				"controller_urls": []interface{}{failing.server.URL, fc.URL()},
+				"user":            fakeLegacyUser,
+				"password":        fakeLegacyPassword,
+				"max_retries":     0,
+				"disable_cache":   true,
+			})
+
+			_, err := config.decsAPICall(context.Background(), "POST", tc.api_name, &url.Values{"machineId": {"1"}})
+			if tc.switched && err != nil {
+				t.Fatalf("API call did not fail over to the healthy node: %s", err)
+			}
+			if !tc.switched && err == nil {
+				t.Fatalf("API call was expected to fail on the first node.")
+			}
+			if count := fc.callCount(tc.api_name); tc.switched != (count == 1) {
+				t.Errorf("API %q was called %d times on the healthy node.", tc.api_name, count)
+			}
+			if switched := config.endpoints.current() == fc.URL(); switched != tc.switched {
+				t.Errorf("Active node is %q after failure with status code %d.", config.endpoints.current(), tc.status)
+			}
+		})
+	}
+}
+
+func TestProbeEndpoint(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := testControllerConfigLegacy(t, fc)
+
+	for _, tc := range []struct {
+		status int
+		healthy bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusNotFound, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusBadGateway, false},
+		{http.StatusServiceUnavailable, false},
+		{http.StatusGatewayTimeout, false},
+	} {
+		node := newFailingNode(fc, tc.status)
+		err := config.probeEndpoint(context.Background(), node.server.URL)
+		node.server.Close()
+		if (err == nil) != tc.healthy {
+			t.Errorf("Probe of the node replying with status code %d returned %v.", tc.status, err)
+		}
+	}
+}
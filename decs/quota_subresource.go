@@ -27,6 +27,8 @@ import (
 	"github.com/hashicorp/terraform/helper/schema"
 	// "github.com/hashicorp/terraform/helper/validation"
 
+	"github.com/terraform-provider-decs/decs/client"
+
 )
 
 func makeQuotaConfig(arg_list []interface{}) (ResgroupQuotaConfig, int) {
@@ -63,7 +65,7 @@ func makeQuotaConfig(arg_list []interface{}) (ResgroupQuotaConfig, int) {
 	return quota, 1
 } 
 
-func flattenQuota(quotas QuotaRecord) []interface{} {
+func flattenQuota(quotas client.QuotaRecord) []interface{} {
 	quotas_map :=  make(map[string]interface{})
 
 	quotas_map["cpu"] = quotas.Cpu
@@ -0,0 +1,218 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sync"
+
+)
+
+// In record mode every API call made by decsAPICall is appended to the cassette file together with
+// the controller response. In replay mode the responses are served from the cassette file and no
+// network connections are made at all. The cassette is a text file with one JSON object per line.
+// Secret parameters and secret fields of the responses are redacted before they are written, so
+// the cassette can be attached to a bug report.
+//
+// Cassette is appended to rather than overwritten, because Terraform starts the provider separately
+// for plan and apply. Remove the file before recording a new session.
+
+const (
+	RECORDING_OFF    = ""
+	RECORDING_RECORD = "record"
+	RECORDING_REPLAY = "replay"
+)
+
+func recordingModes() []string {
+	return []string{RECORDING_RECORD, RECORDING_REPLAY}
+}
+
+const (
+	cassetteKindSession = "session" // established session, Body holds the DECS user name
+	cassetteKindAPI     = "api"     // single API call with the controller response
+)
+
+type cassetteEntry struct {
+	Kind string     `json:"kind"`
+	Mode string     `json:"mode,omitempty"`   // authenticator mode for session entries
+	Method string   `json:"method,omitempty"`
+	API string      `json:"api,omitempty"`
+	Params string   `json:"params,omitempty"` // URL encoded API call parameters with secrets redacted
+	Status int      `json:"status,omitempty"`
+	Body string     `json:"body"`             // raw response body with secrets redacted
+}
+
+type apiRecorder struct {
+	mode string
+	file_name string
+	mutex sync.Mutex
+	file *os.File                          // cassette opened for appending in record mode
+	session *cassetteEntry                 // first recorded session in replay mode
+	entries map[string][]*cassetteEntry   // recorded API calls indexed by cassetteKey() in replay mode
+	served map[string]int                  // number of entries already served for each key in replay mode
+}
+
+func cassetteKey(method string, api_name string, params string) string {
+	return fmt.Sprintf("%s %s?%s", method, api_name, params)
+}
+
+func newAPIRecorder(mode string, file_name string) (*apiRecorder, error) {
+	// Return nil recorder if recording is off.
+	if mode == RECORDING_OFF {
+		return nil, nil
+	}
+	if file_name == "" {
+		return nil, fmt.Errorf("Recording mode %q is set but no recording file provided.", mode)
+	}
+
+	recorder := &apiRecorder{mode: mode, file_name: file_name}
+	switch mode {
+	case RECORDING_RECORD:
+		file, err := os.OpenFile(file_name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to open recording file: %s", err)
+		}
+		recorder.file = file
+		log.Printf("newAPIRecorder: recording DECS controller traffic to %q", file_name)
+	case RECORDING_REPLAY:
+		err := recorder.load()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("newAPIRecorder: replaying DECS controller traffic from %q", file_name)
+	default:
+		return nil, fmt.Errorf("Unknown recording mode %q provided.", mode)
+	}
+	return recorder, nil
+}
+
+func (recorder *apiRecorder) replaying() bool {
+	return recorder != nil && recorder.mode == RECORDING_REPLAY
+}
+
+func (recorder *apiRecorder) recording() bool {
+	return recorder != nil && recorder.mode == RECORDING_RECORD
+}
+
+func (recorder *apiRecorder) load() error {
+	file, err := os.Open(recorder.file_name)
+	if err != nil {
+		return fmt.Errorf("Failed to open recording file: %s", err)
+	}
+	defer file.Close()
+
+	recorder.entries = make(map[string][]*cassetteEntry)
+	recorder.served = make(map[string]int)
+	line_num := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024) // responses with long lists may be large
+	for scanner.Scan() {
+		line_num += 1
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := &cassetteEntry{}
+		err = json.Unmarshal(scanner.Bytes(), entry)
+		if err != nil {
+			return fmt.Errorf("%s:%d: malformed recording: %s", recorder.file_name, line_num, err)
+		}
+		switch entry.Kind {
+		case cassetteKindSession:
+			if recorder.session == nil {
+				recorder.session = entry
+			}
+		case cassetteKindAPI:
+			key := cassetteKey(entry.Method, entry.API, entry.Params)
+			recorder.entries[key] = append(recorder.entries[key], entry)
+		default:
+			return fmt.Errorf("%s:%d: unknown recording kind %q.", recorder.file_name, line_num, entry.Kind)
+		}
+	}
+	return scanner.Err()
+}
+
+func (recorder *apiRecorder) write(entry *cassetteEntry) {
+	// Failure to record is logged, but does not fail the API call
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("apiRecorder: cannot encode recording: %s", err)
+		return
+	}
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	_, err = recorder.file.Write(append(data, '\n'))
+	if err != nil {
+		log.Printf("apiRecorder: cannot write to recording file %q: %s", recorder.file_name, err)
+	}
+}
+
+func (recorder *apiRecorder) recordSession(auth_mode string, decs_username string) {
+	recorder.write(&cassetteEntry{
+		Kind: cassetteKindSession,
+		Mode: auth_mode,
+		Body: decs_username,
+	})
+}
+
+func (recorder *apiRecorder) recordCall(method string, api_name string, url_values *url.Values, status_code int, resp_body []byte) {
+	recorder.write(&cassetteEntry{
+		Kind:   cassetteKindAPI,
+		Method: method,
+		API:    api_name,
+		Params: redactValues(*url_values),
+		Status: status_code,
+		Body:   redactText(string(resp_body)),
+	})
+}
+
+func (recorder *apiRecorder) replaySession() (string, error) {
+	// Return DECS user name of the recorded session
+	if recorder.session == nil {
+		return "", fmt.Errorf("No session found in recording file %q.", recorder.file_name)
+	}
+	return recorder.session.Body, nil
+}
+
+func (recorder *apiRecorder) replayCall(method string, api_name string, url_values *url.Values) ([]byte, int, error) {
+	// Serve recorded response to the API call with the same method and parameters. Repeated calls
+	// are served the recorded responses in the order they were recorded, the last one is served
+	// once all of them are used up.
+	params := redactValues(*url_values)
+	key := cassetteKey(method, api_name, params)
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	entries := recorder.entries[key]
+	if len(entries) == 0 {
+		return nil, 0, fmt.Errorf("No recorded response for API %q with parameters %q in recording file %q.",
+		                          api_name, params, recorder.file_name)
+	}
+	index := recorder.served[key]
+	if index >= len(entries) {
+		index = len(entries) - 1
+	} else {
+		recorder.served[key] += 1
+	}
+	return []byte(entries[index].Body), entries[index].Status, nil
+}
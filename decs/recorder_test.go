@@ -0,0 +1,101 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func testAccProviderConfigRecording(fc *fakeController, mode string, file_name string) string {
+	return fmt.Sprintf(`
+provider "decs" {
+  authenticator  = "legacy"
+  controller_url = %q
+  user           = %q
+  password       = %q
+  max_retries    = 0
+  recording_mode = %q
+  recording_file = %q
+}
+`, fc.URL(), fakeLegacyUser, fakeLegacyPassword, mode, file_name)
+}
+
+func testAccCheckRecordingRedacted(file_name string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		data, err := ioutil.ReadFile(file_name)
+		if err != nil {
+			return err
+		}
+		for _, secret := range []string{fakeLegacyPassword, "fake-session-", "secret-"} {
+			if strings.Contains(string(data), secret) {
+				return fmt.Errorf("Recording file contains secret %q.", secret)
+			}
+		}
+		return nil
+	}
+}
+
+func TestAccRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "decs-recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file_name := filepath.Join(dir, "cassette.jsonl")
+	vm_config := fmt.Sprintf(testAccVmConfig, fakeTenantName, fakeImageID, fakeExtNetID)
+
+	fc := newFakeController()
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigRecording(fc, RECORDING_RECORD, file_name) + vm_config,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "cpu", "2"),
+					testAccCheckRecordingRedacted(file_name),
+				),
+			},
+		},
+	})
+	fc.Close()
+
+	// the fake controller is gone, so all responses must come from the recording
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders(),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigRecording(fc, RECORDING_REPLAY, file_name) + vm_config,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "cpu", "2"),
+					testAccCheckVmPortforwardAttr("decs_vm.vm", 2222, 22, "tcp", "ext_port", "2222"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "password", RedactedValue),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,93 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"net/url"
+	"regexp"
+	"strings"
+
+)
+
+// placeholder that replaces secret values in error messages and log output
+const RedactedValue = "REDACTED"
+
+// names of API parameters and response fields, which values must never appear in error messages
+// and log output (names are matched case insensitive)
+var secretKeys = []string{
+	"authkey",
+	"password",
+	"passwd",
+	"client_secret",
+	"app_secret",
+	"secret",
+	"jwt",
+	"token",
+	"access_token",
+	"id_token",
+}
+
+var secretKeysPattern = strings.Join(secretKeys, "|")
+
+var redactPatterns = []struct {
+	re *regexp.Regexp
+	repl string
+}{
+	// JSON or Python dictionary: "password": "value", 'password': u'value'
+	{ regexp.MustCompile(`(?i)(["']?\b(?:` + secretKeysPattern + `)["']?\s*:\s*u?)"(?:[^"\\]|\\.)*"`), `${1}"` + RedactedValue + `"` },
+	{ regexp.MustCompile(`(?i)(["']?\b(?:` + secretKeysPattern + `)["']?\s*:\s*u?)'(?:[^'\\]|\\.)*'`), `${1}'` + RedactedValue + `'` },
+	// URL encoded request body or query string: authkey=value&...
+	{ regexp.MustCompile(`(?i)((?:^|[?&\s"'])(?:` + secretKeysPattern + `)=)[^&\s"']*`), `${1}` + RedactedValue },
+	// Authorization header value
+	{ regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-_.~+/]+=*`), `${1}` + RedactedValue },
+	// anything else that looks like JWT
+	{ regexp.MustCompile(`eyJ[A-Za-z0-9\-_]+\.[A-Za-z0-9\-_]+\.[A-Za-z0-9\-_]*`), RedactedValue },
+}
+
+func isSecretKey(key string) bool {
+	for _, secret_key := range secretKeys {
+		if strings.EqualFold(key, secret_key) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactValues(values url.Values) string {
+	// Encode API call parameters for use in error messages and log output with the values of
+	// secret parameters replaced by placeholder.
+	safe_values := url.Values{}
+	for key, value := range values {
+		if isSecretKey(key) {
+			safe_values.Set(key, RedactedValue)
+		} else {
+			safe_values[key] = value
+		}
+	}
+	return safe_values.Encode()
+}
+
+func redactText(text string) string {
+	// Scrub secret values from arbitrary text, e.g. API response body, before it is logged or
+	// included in error message.
+	for _, pattern := range redactPatterns {
+		text = pattern.re.ReplaceAllString(text, pattern.repl)
+	}
+	return text
+}
@@ -20,11 +20,13 @@ import (
 
 	"fmt"
 	"log"
-	"net/url"
 	"strconv"
+	"strings"
 	
 	"github.com/hashicorp/terraform/helper/schema"
 
+	"github.com/terraform-provider-decs/decs/client"
+
 )
 
 func resourceResgroupCreate(d *schema.ResourceData, m interface{}) error {
@@ -47,9 +49,13 @@ func resourceResgroupCreate(d *schema.ResourceData, m interface{}) error {
 	}
 	// tenant ID is required to create new resource group
 	// obtain Tenant ID by tenant name - it should not be zero on success
-	tenant_id, err := utilityGetTenantIdByName(rg.TenantName, m)
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutCreate)
+	defer cancel()
+
+	tenant_id, err := utilityGetTenantIdByName(ctx, rg.TenantName, m)
 	if err != nil {
-		return err
+		return explainAPIError(err, fmt.Sprintf("look up tenant %q", rg.TenantName))
 	}
 	rg.TenantID = tenant_id
 
@@ -61,37 +67,44 @@ func resourceResgroupCreate(d *schema.ResourceData, m interface{}) error {
 		set_quotas = true
 	}
 
-	controller := m.(*ControllerCfg)
+	decs_username, err := controller.getDecsUsername(ctx)
+	if err != nil {
+		return explainAPIError(err, "authenticate to DECS controller")
+	}
 	log.Printf("resourceResgroupCreate: called by user %q for Resource group name %q, for tenant  %q / ID %d, location %q",
-	            controller.getDecsUsername(),
+	            decs_username,
 				rg.Name, d.Get("tenant"), rg.TenantID, rg.Location)
 				
-	url_values := &url.Values{}
-	url_values.Add("accountId", fmt.Sprintf("%d", rg.TenantID))
-	url_values.Add("name", rg.Name)
-	url_values.Add("location", rg.Location)
-	url_values.Add("access", controller.getDecsUsername())
+	create_param := &client.ResgroupCreateParam{
+		TenantID: rg.TenantID,
+		Name:     rg.Name,
+		Location: rg.Location,
+		Owner:    decs_username,
+	}
 	// pass quota values as set
 	if set_quotas {
-		url_values.Add("maxCPUCapacity", fmt.Sprintf("%d", rg.Quota.Cpu))
-		url_values.Add("maxVDiskCapacity", fmt.Sprintf("%d", rg.Quota.Disk))
-		url_values.Add("maxMemoryCapacity", fmt.Sprintf("%f", rg.Quota.Ram))
-		url_values.Add("maxNetworkPeerTransfer", fmt.Sprintf("%d", rg.Quota.NetTraffic))
-		url_values.Add("maxNumPublicIP", fmt.Sprintf("%d", rg.Quota.ExtIPs))
+		create_param.Cpu = &rg.Quota.Cpu
+		create_param.Disk = &rg.Quota.Disk
+		create_param.Ram = &rg.Quota.Ram
+		create_param.NetTraffic = &rg.Quota.NetTraffic
+		create_param.ExtIPs = &rg.Quota.ExtIPs
 	}
 	// pass externalnetworkid if set
 	arg_value, arg_set = d.GetOk("extnet_id")
 	if arg_set {
-		url_values.Add("externalnetworkid", fmt.Sprintf("%d", arg_value))
+		create_param.ExtNetID = arg_value.(int)
 	}
 	
-	api_resp, err := controller.decsAPICall("POST", ResgroupCreateAPI, url_values)
+	rg.ID, err = controller.api.Cloudspaces.Create(ctx, create_param)
 	if err != nil {
-		return err
+		return explainAPIError(err, fmt.Sprintf("create resource group %q for tenant %q", rg.Name, rg.TenantName))
 	}
+	d.SetId(strconv.Itoa(rg.ID))
 
-	d.SetId(api_resp) // cloudspaces/create API plainly returns ID of the newly creted resource group on success
-	rg.ID, _ = strconv.Atoi(api_resp)
+	err = controller.utilityResgroupWaitForStatus(ctx, rg.ID)
+	if err != nil {
+		return err
+	}
 
 	return resourceResgroupRead(d, m)
 }
@@ -99,12 +112,19 @@ func resourceResgroupCreate(d *schema.ResourceData, m interface{}) error {
 func resourceResgroupRead(d *schema.ResourceData, m interface{}) error {
 	log.Printf("resourceResgroupRead: called for res group name %q, tenant name %q", 
 	           d.Get("name").(string), d.Get("tenant").(string))
-	rg_facts, err := utilityResgroupCheckPresence(d, m)
-	if rg_facts == "" {
-		// if empty string is returned from utilityResgroupCheckPresence then there is no
-		// such resource group and err tells so - just return it to the calling party 
-		d.SetId("") // ensure ID is empty
-		return err
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutRead)
+	defer cancel()
+
+	rg_facts, err := utilityResgroupCheckPresence(ctx, d, m)
+	if rg_facts == nil {
+		if err != nil {
+			// we do not know if the resource group exists, so keep it in the state
+			return explainAPIError(err, fmt.Sprintf("read resource group %q", d.Get("name").(string)))
+		}
+		// resource group was not found - let Terraform know that it is gone
+		d.SetId("")
+		return nil
 	}
 
 	return flattenResgroup(d, rg_facts)
@@ -127,47 +147,51 @@ func resourceResgroupUpdate(d *schema.ResourceData, m interface{}) error {
 	quotaconfig_old, _ := makeQuotaConfig(quota_value.([]interface{}))
 
 	controller := m.(*ControllerCfg)
-	url_values := &url.Values{}
-	url_values.Add("cloudspaceId", d.Id())
-	url_values.Add("name", d.Get("name").(string))
+	ctx, cancel := controller.operationContext(d, schema.TimeoutUpdate)
+	defer cancel()
+	rgid, _ := strconv.Atoi(d.Id())
+	update_param := &client.CloudspacesUpdateParam{
+		ID:   uint(rgid),
+		Name: d.Get("name").(string),
+	}
 	
 	do_update := false
 
 	if quotaconfig_new.Cpu != quotaconfig_old.Cpu {
 		do_update = true
 		log.Printf("resourceResgroupUpdate: Cpu diff %d <- %d", quotaconfig_new.Cpu, quotaconfig_old.Cpu)
-		url_values.Add("maxCPUCapacity", fmt.Sprintf("%d", quotaconfig_new.Cpu))
+		update_param.Cpu = &quotaconfig_new.Cpu
 	}
 
 	if quotaconfig_new.Disk != quotaconfig_old.Disk {
 		do_update = true
 		log.Printf("resourceResgroupUpdate: Disk diff %d <- %d", quotaconfig_new.Disk, quotaconfig_old.Disk)
-		url_values.Add("maxVDiskCapacity", fmt.Sprintf("%d", quotaconfig_new.Disk))
+		update_param.Disk = &quotaconfig_new.Disk
 	}
 
 	if quotaconfig_new.Ram != quotaconfig_old.Ram {
 		do_update = true
 		log.Printf("resourceResgroupUpdate: Ram diff %f <- %f", quotaconfig_new.Ram, quotaconfig_old.Ram)
-		url_values.Add("maxMemoryCapacity", fmt.Sprintf("%f", quotaconfig_new.Ram))
+		update_param.Ram = &quotaconfig_new.Ram
 	}
 
 	if quotaconfig_new.NetTraffic != quotaconfig_old.NetTraffic {
 		do_update = true
 		log.Printf("resourceResgroupUpdate: NetTraffic diff %d <- %d", quotaconfig_new.NetTraffic, quotaconfig_old.NetTraffic)
-		url_values.Add("maxNetworkPeerTransfer", fmt.Sprintf("%d", quotaconfig_new.NetTraffic))
+		update_param.NetTraffic = &quotaconfig_new.NetTraffic
 	}
 
 	if quotaconfig_new.ExtIPs != quotaconfig_old.ExtIPs {
 		do_update = true
 		log.Printf("resourceResgroupUpdate: ExtIPs diff %d <- %d", quotaconfig_new.ExtIPs, quotaconfig_old.ExtIPs)
-		url_values.Add("maxNumPublicIP", fmt.Sprintf("%d", quotaconfig_new.ExtIPs))
+		update_param.ExtIPs = &quotaconfig_new.ExtIPs
 	}
 
 	if do_update {
 		log.Printf("resourceResgroupUpdate: some new quotas are set - updating the resource")
-		_, err := controller.decsAPICall("POST", ResgroupUpdateAPI, url_values)
+		err := controller.api.Cloudspaces.Update(ctx, update_param)
 		if err != nil {
-			return err
+			return explainAPIError(err, fmt.Sprintf("update quotas of resource group ID %s", d.Id()))
 		}
 	} else {
 		log.Printf("resourceResgroupUpdate: no difference in quotas between old and new state - no update on this resource will be done")
@@ -182,21 +206,28 @@ func resourceResgroupDelete(d *schema.ResourceData, m interface{}) error {
 	log.Printf("resourceResgroupDelete: called for res group name %q, tenant name %q", 
 			   d.Get("name").(string), d.Get("tenant").(string))
 
-	vm_facts, err := utilityResgroupCheckPresence(d, m)
-	if vm_facts == "" {
-		// the target VM does not exist - in this case according to Terraform best practice 
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutDelete)
+	defer cancel()
+
+	rg_facts, err := utilityResgroupCheckPresence(ctx, d, m)
+	if rg_facts == nil {
+		if err != nil {
+			return explainAPIError(err, fmt.Sprintf("look up resource group %q", d.Get("name").(string)))
+		}
+		// the target resource group does not exist - in this case according to Terraform best practice 
 		// we exit from Destroy method without error
 		return nil
 	}
 
-	params := &url.Values{}
-	params.Add("cloudspaceId", d.Id())
-	params.Add("permanently", "true")
-
-	controller := m.(*ControllerCfg)
-	vm_facts, err = controller.decsAPICall("POST", CloudspacesDeleteAPI, params)
+	err = controller.api.Cloudspaces.Delete(ctx, int(rg_facts.ID), true)
 	if err != nil {
-		return err
+		if isNotFoundError(err) {
+			// resource group has disappeared after we checked for its presence, which is just as good
+			log.Printf("resourceResgroupDelete: resource group ID %s is already gone", d.Id())
+			return nil
+		}
+		return explainAPIError(err, fmt.Sprintf("delete resource group ID %s", d.Id()))
 	}
 
 	return nil
@@ -204,8 +235,12 @@ func resourceResgroupDelete(d *schema.ResourceData, m interface{}) error {
 
 func resourceResgroupExists(d *schema.ResourceData, m interface{}) (bool, error) {
 	// Reminder: according to Terraform rules, this function should not modify ResourceData argument
-	rg_facts, err := utilityResgroupCheckPresence(d, m)
-	if rg_facts == "" {
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutRead)
+	defer cancel()
+
+	rg_facts, err := utilityResgroupCheckPresence(ctx, d, m)
+	if rg_facts == nil {
 		if err != nil {
 			return false, err
 		}
@@ -214,6 +249,53 @@ func resourceResgroupExists(d *schema.ResourceData, m interface{}) (bool, error)
 	return true, nil
 }
 
+func resourceResgroupImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	// Resource group can be imported either by its ID or by "<tenant name>/<resource group name>"
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutRead)
+	defer cancel()
+
+	var rg_facts *client.CloudspacesGetResp
+	var err error
+	if pos := strings.Index(d.Id(), "/"); pos >= 0 {
+		rg_facts, err = utilityResgroupFindByName(ctx, d.Id()[:pos], d.Id()[pos+1:], m)
+	} else {
+		rgid, conv_err := strconv.Atoi(d.Id())
+		if conv_err != nil {
+			return nil, fmt.Errorf("Cannot import resource group %q: expected resource group ID or <tenant name>/<resource group name>.", d.Id())
+		}
+		rg_facts, err = utilityResgroupGetByID(ctx, rgid, m)
+		if rg_facts == nil && err == nil {
+			err = fmt.Errorf("Cannot find resource group ID %d", rgid)
+		}
+	}
+	if err != nil {
+		return nil, explainAPIError(err, fmt.Sprintf("import resource group %q", d.Id()))
+	}
+
+	// tenant is referred to by name in the configuration, but only its ID is returned by cloudspaces/get
+	tenant_name, err := utilityGetTenantNameByID(ctx, rg_facts.TenantID, m)
+	if err != nil {
+		return nil, explainAPIError(err, fmt.Sprintf("import resource group %q", d.Id()))
+	}
+	d.SetId(strconv.Itoa(int(rg_facts.ID)))
+	d.Set("tenant", tenant_name)
+	d.Set("location", rg_facts.Location)
+	return []*schema.ResourceData{d}, nil
+}
+
+func resourceResgroupCustomizeDiff(d *schema.ResourceDiff, m interface{}) error {
+	// Resource groups are currently implemented on top of cloudspaces, so new resource group can
+	// only be created if DECS controller still provides cloudspaces API
+	if d.Id() != "" {
+		return nil
+	}
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.planContext()
+	defer cancel()
+	return controller.requireCapability(ctx, CAP_CLOUDSPACES)
+}
+
 func resourceResgroup() *schema.Resource {
 	return &schema.Resource {
 		SchemaVersion: 1,
@@ -224,6 +306,12 @@ func resourceResgroup() *schema.Resource {
 		Delete: resourceResgroupDelete,
 		Exists: resourceResgroupExists,
 
+		Importer: &schema.ResourceImporter{
+			State: resourceResgroupImport,
+		},
+
+		CustomizeDiff: resourceResgroupCustomizeDiff,
+
 		Timeouts: &schema.ResourceTimeout {
 			Create:  &Timeout180s,
 			Read:    &Timeout30s,
@@ -0,0 +1,231 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+
+	"github.com/terraform-provider-decs/decs/client"
+)
+
+const testAccResgroupConfig = `
+resource "decs_resgroup" "rg" {
+  name     = "tf-acc-rg"
+  tenant   = %q
+  location = "fake-location"
+  quotas {
+    cpu = %d
+    ram = 16
+  }
+}
+`
+
+func testAccCheckResgroupQuota(fc *fakeController, name string, cpu int) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rg := fc.findCloudspace(name)
+		if rg == nil {
+			return fmt.Errorf("Resource group %q not found in fake DECS controller.", name)
+		}
+		if rg.Quotas.Cpu != cpu {
+			return fmt.Errorf("Resource group %q has CPU quota %d, expected %d.", name, rg.Quotas.Cpu, cpu)
+		}
+		return nil
+	}
+}
+
+func testAccCheckFakeEmpty(fc *fakeController) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if count := fc.objectCount(); count != 0 {
+			return fmt.Errorf("%d objects left in fake DECS controller after destroy.", count)
+		}
+		return nil
+	}
+}
+
+func TestAccResgroup(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccResgroupConfig, fakeTenantName, 4),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("decs_resgroup.rg", "id"),
+					resource.TestCheckResourceAttr("decs_resgroup.rg", "tenant_id", fmt.Sprintf("%d", fakeTenantID)),
+					resource.TestCheckResourceAttr("decs_resgroup.rg", "grid_id", fmt.Sprintf("%d", fakeGridID)),
+					resource.TestCheckResourceAttrSet("decs_resgroup.rg", "public_ip"),
+					resource.TestCheckResourceAttr("decs_resgroup.rg", "quotas.0.cpu", "4"),
+					resource.TestCheckResourceAttr("decs_resgroup.rg", "quotas.0.ram", "16"),
+					resource.TestCheckResourceAttr("decs_resgroup.rg", "quotas.0.disk", "-1"),
+					testAccCheckResgroupQuota(fc, "tf-acc-rg", 4),
+				),
+			},
+			{
+				// quota change is applied in place
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccResgroupConfig, fakeTenantName, 8),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_resgroup.rg", "quotas.0.cpu", "8"),
+					testAccCheckResgroupQuota(fc, "tf-acc-rg", 8),
+				),
+			},
+		},
+	})
+}
+
+func TestAccResgroupCreateTimeout(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	defer testAccSetStatusPollInterval(time.Millisecond * 10)()
+	// resource group never leaves DEPLOYING status within the create timeout
+	fc.settle_gets = 1000000
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(`
+resource "decs_resgroup" "rg" {
+  name     = "tf-acc-rg"
+  tenant   = %q
+  location = "fake-location"
+
+  timeouts {
+    create = "1s"
+  }
+}
+`, fakeTenantName),
+				ExpectError: regexp.MustCompile(`Timed out while trying to wait for resource group ID \d+ to reach DEPLOYED or VIRTUAL status, last seen status "DEPLOYING"`),
+			},
+		},
+	})
+}
+
+func TestAccResgroupImport(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccResgroupConfig, fakeTenantName, 4),
+			},
+			{
+				Config:            testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccResgroupConfig, fakeTenantName, 4),
+				ResourceName:      "decs_resgroup.rg",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				Config:            testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccResgroupConfig, fakeTenantName, 4),
+				ResourceName:      "decs_resgroup.rg",
+				ImportState:       true,
+				ImportStateId:     fakeTenantName + "/tf-acc-rg",
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestAccResgroupRemovedOutside(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	var rgid string
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccResgroupConfig, fakeTenantName, 4),
+				Check: func(s *terraform.State) error {
+					rgid = s.RootModule().Resources["decs_resgroup.rg"].Primary.ID
+					return nil
+				},
+			},
+			{
+				// resource group that is gone must be created anew rather than fail the refresh
+				PreConfig: func() { fc.removeCloudspace("tf-acc-rg") },
+				Config:    testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccResgroupConfig, fakeTenantName, 4),
+				Check: func(s *terraform.State) error {
+					if id := s.RootModule().Resources["decs_resgroup.rg"].Primary.ID; id == rgid {
+						return fmt.Errorf("Resource group ID %s removed outside of Terraform was not replaced.", id)
+					}
+					return testAccCheckResgroupQuota(fc, "tf-acc-rg", 4)(s)
+				},
+			},
+		},
+	})
+}
+
+func TestResgroupReadDeleteFailure(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := testControllerConfigLegacy(t, fc)
+	rgid := fc.addCloudspace("tf-acc-rg")
+	d := schema.TestResourceDataRaw(t, resourceResgroup().Schema, map[string]interface{}{
+		"name":     "tf-acc-rg",
+		"tenant":   fakeTenantName,
+		"location": "fake-location",
+	})
+	d.SetId(strconv.Itoa(rgid))
+
+	// failure to get resource group must not be taken for its absence
+	fc.failCalls(client.CloudspacesGetAPI, http.StatusInternalServerError, 1)
+	err := resourceResgroupRead(d, config)
+	if err == nil {
+		t.Fatalf("Expected read of resource group to fail.")
+	}
+	if d.Id() != strconv.Itoa(rgid) {
+		t.Errorf("Resource group ID %d was removed from the state after failed read.", rgid)
+	}
+
+	fc.failCalls(client.CloudspacesGetAPI, http.StatusInternalServerError, 1)
+	err = resourceResgroupDelete(d, config)
+	if err == nil {
+		t.Fatalf("Expected delete of resource group to fail.")
+	}
+	if fc.findCloudspace("tf-acc-rg") == nil {
+		t.Fatalf("Resource group was deleted in spite of the failure.")
+	}
+
+	// once the controller recovers, resource group is deleted and then read as gone
+	err = resourceResgroupDelete(d, config)
+	if err != nil {
+		t.Fatalf("Cannot delete resource group: %s", err)
+	}
+	err = resourceResgroupRead(d, config)
+	if err != nil || d.Id() != "" {
+		t.Fatalf("Expected deleted resource group to be read as gone, got ID %q, error %v", d.Id(), err)
+	}
+}
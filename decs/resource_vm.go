@@ -19,14 +19,15 @@ package decs
 
 import (
 
-	"encoding/json"
 	"fmt"
 	"log"
-	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
+
+	"github.com/terraform-provider-decs/decs/client"
 )
 
 
@@ -45,6 +46,9 @@ func resourceVmCreate(d *schema.ResourceData, m interface{}) error {
 	// PortForwards
 	// SshKeyData string
 	log.Printf("resourceVmCreate: called for VM name %q, ResGroupID %d", machine.Name, machine.ResGroupID)
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutCreate)
+	defer cancel()
 	
 	var subres_list []interface{}
 	var subres_data map[string]interface{}
@@ -75,7 +79,7 @@ func resourceVmCreate(d *schema.ResourceData, m interface{}) error {
 	arg_value, arg_set = d.GetOk("port_forwards")
 	if arg_set {
 		log.Printf("resourceVmCreate: calling makePortforwardsConfig")
-		machine.PortForwards, _ = makePortforwardsConfig(arg_value.([]interface{}))
+		machine.PortForwards, _ = makePortforwardsConfig(arg_value.(*schema.Set).List())
 	}
 	
 	arg_value, arg_set = d.GetOk("ssh_keys")
@@ -87,24 +91,24 @@ func resourceVmCreate(d *schema.ResourceData, m interface{}) error {
 	// create basic VM (i.e. without port forwards and ext network connections - those will be done
 	// by separate API calls)
 	d.Partial(true)
-	controller := m.(*ControllerCfg)
-	url_values := &url.Values{}
-	url_values.Add("cloudspaceId", fmt.Sprintf("%d", machine.ResGroupID))
-	url_values.Add("name", machine.Name)
-	url_values.Add("description", machine.Description)
-	url_values.Add("vcpus", fmt.Sprintf("%d", machine.Cpu))
-	url_values.Add("memory", fmt.Sprintf("%d", machine.Ram))
-	url_values.Add("imageId", fmt.Sprintf("%d", machine.ImageID))
-	url_values.Add("disksize", fmt.Sprintf("%d", machine.BootDisk.Size))
+	create_param := &client.MachineCreateParam{
+		ResGroupID:  uint(machine.ResGroupID),
+		Name:        machine.Name,
+		Description: machine.Description,
+		Cpu:         machine.Cpu,
+		Ram:         machine.Ram,
+		ImageID:     machine.ImageID,
+		BootDisk:    machine.BootDisk.Size,
+	}
 	if len(machine.SshKeys) > 0 {
-		url_values.Add("userdata", makeSshKeysArgString(machine.SshKeys))
+		create_param.UserData = makeSshKeysArgString(machine.SshKeys)
 	}
-	api_resp, err := controller.decsAPICall("POST", MachineCreateAPI, url_values)
+	vm_id, err := controller.api.Machines.Create(ctx, create_param)
 	if err != nil {
-		return err
+		return explainAPIError(err, fmt.Sprintf("create VM %q in resource group ID %d", machine.Name, machine.ResGroupID))
 	}
-	d.SetId(api_resp) // machines/create API plainly returns ID of the new VM on success
-	machine.ID, _ = strconv.Atoi(api_resp)
+	machine.ID = vm_id
+	d.SetId(strconv.Itoa(vm_id))
 	d.SetPartial("name")
 	d.SetPartial("description")
 	d.SetPartial("cpu")
@@ -117,13 +121,22 @@ func resourceVmCreate(d *schema.ResourceData, m interface{}) error {
 
 	log.Printf("resourceVmCreate: new VM ID %d, name %q created", machine.ID, machine.Name)
 
+	// disks and networks cannot be attached to the VM while it is still being deployed
+	err = controller.utilityVmWaitForStatus(ctx, machine.ID)
+	if err != nil {
+		return err
+	}
+
 	if len(machine.DataDisks) > 0 || len(machine.PortForwards) > 0 {
 		// for data disk or port foreards provisioning we have to know Tenant ID
 		// and Grid ID so we call utilityResgroupConfigGet method to populate these 
 		// fields in the machine structure that will be passed to provisionVmDisks or
 		// provisionVmPortforwards
 		log.Printf("resourceVmCreate: calling utilityResgroupConfigGet")
-		resgroup, err := controller.utilityResgroupConfigGet(machine.ResGroupID)
+		resgroup, err := controller.utilityResgroupConfigGet(ctx, machine.ResGroupID)
+		if isContextError(err) {
+			return explainAPIError(err, fmt.Sprintf("read resource group ID %d", machine.ResGroupID))
+		}
 		if err == nil {
 			machine.TenantID = resgroup.TenantID
 			machine.GridID = resgroup.GridID
@@ -147,8 +160,12 @@ func resourceVmCreate(d *schema.ResourceData, m interface{}) error {
 			// provisionVmDisks accomplishes two steps for each data disk specification
 			// 1) creates the disks
 			// 2) attaches them to the VM
-			err = controller.utilityVmDisksProvision(machine)
+			err = controller.utilityVmDisksProvision(ctx, machine)
+			if isContextError(err) {
+				return err
+			}
 			if err != nil {
+				log.Printf("resourceVmCreate: %s", err)
 				disks_ok = false
 			}
 		}
@@ -169,8 +186,12 @@ func resourceVmCreate(d *schema.ResourceData, m interface{}) error {
 			// hence we do not have technical ability to provision port forwards
 			pfws_ok = false
 		} else {
-			err := controller.utilityVmPortforwardsProvision(machine)
+			err := controller.utilityVmPortforwardsProvision(ctx, machine)
+			if isContextError(err) {
+				return err
+			}
 			if err != nil {
+				log.Printf("resourceVmCreate: %s", err)
 				pfws_ok = false
 			}	
 		}
@@ -187,8 +208,12 @@ func resourceVmCreate(d *schema.ResourceData, m interface{}) error {
 	nets_ok := true
 	if len(machine.Networks) > 0 {
 		log.Printf("resourceVmCreate: calling utilityVmNetworksProvision for networks count %d", len(machine.Networks))
-		err := controller.utilityVmNetworksProvision(machine)
+		err := controller.utilityVmNetworksProvision(ctx, machine)
+		if isContextError(err) {
+			return err
+		}
 		if err != nil {
+			log.Printf("resourceVmCreate: %s", err)
 			nets_ok = false
 		}
 	}
@@ -197,6 +222,14 @@ func resourceVmCreate(d *schema.ResourceData, m interface{}) error {
 		d.SetPartial("networks")
 	}
 
+	if len(machine.DataDisks) > 0 || len(machine.Networks) > 0 {
+		// attaching disks and networks may put the VM into transition for a while
+		err = controller.utilityVmWaitForStatus(ctx, machine.ID)
+		if err != nil {
+			return err
+		}
+	}
+
 	if ( disks_ok && nets_ok && pfws_ok ) {
 		// if there were no errors in setting any of the subresources, we may leave Partial mode
 		d.Partial(false)
@@ -210,13 +243,17 @@ func resourceVmCreate(d *schema.ResourceData, m interface{}) error {
 func resourceVmRead(d *schema.ResourceData, m interface{}) error {
 	log.Printf("resourceVmRead: called for VM name %q, ResGroupID %d", 
 	           d.Get("name").(string), d.Get("rgid").(int))
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutRead)
+	defer cancel()
 	
-	vm_facts, err := utilityVmCheckPresence(d, m)
-	if vm_facts == "" {
+	vm_facts, err := utilityVmCheckPresence(ctx, d, m)
+	if vm_facts == nil {
 		if err != nil {
-			return err
+			return explainAPIError(err, fmt.Sprintf("read VM %q", d.Get("name").(string)))
 		}
-		// VM was not found
+		// VM was not found - let Terraform know that it is gone
+		d.SetId("")
 		return nil
 	}
 
@@ -228,13 +265,11 @@ func resourceVmRead(d *schema.ResourceData, m interface{}) error {
 
 	// Not all parameters, that we may need, are returned by machines/get API
 	// Continue with further reading of VM subresource parameters:
-	controller := m.(*ControllerCfg)
-	url_values := &url.Values{}
 
 	/*
 	// Obtain information on external networks
 	url_values.Add("machineId", d.Id())
-	body_string, err := controller.decsAPICall("POST", VmExtNetworksListAPI, url_values)
+	body_string, err := controller.decsAPICall(ctx, "POST", VmExtNetworksListAPI, url_values)
 	if err != nil {
 		return err
 	}
@@ -263,22 +298,15 @@ func resourceVmRead(d *schema.ResourceData, m interface{}) error {
 
 	//
 	// Obtain information on port forwards
-	url_values.Add("cloudspaceId", fmt.Sprintf("%d",d.Get("rgid")))
-	url_values.Add("machineId", d.Id())
-	pfw_list := PortforwardsResp{}
-	body_string, err := controller.decsAPICall("POST", PortforwardsListAPI, url_values)
+	vm_id, _ := strconv.Atoi(d.Id())
+	pfw_list, err := controller.api.Portforwarding.List(ctx, d.Get("rgid").(int), vm_id)
 	if err != nil {
-		return err
-	}
-	err = json.Unmarshal([]byte(body_string), &pfw_list)
-	if err != nil {
-		return err
+		return explainAPIError(err, fmt.Sprintf("read port forwards of VM ID %s", d.Id()))
 	}
 
-	if len(pfw_list) > 0 {
-		if err = d.Set("port_forwards", flattenPortforwards(pfw_list)); err != nil {
-			return err
-		}
+	// port forwards are set even if there are none, so that rules deleted outside of Terraform are noticed
+	if err = d.Set("port_forwards", flattenPortforwards(pfw_list)); err != nil {
+		return err
 	}
 
 	return nil
@@ -287,7 +315,73 @@ func resourceVmRead(d *schema.ResourceData, m interface{}) error {
 func resourceVmUpdate(d *schema.ResourceData, m interface{}) error {
 	log.Printf("resourceVmUpdate: called for VM name %q, ResGroupID %d", 
 			   d.Get("name").(string), d.Get("rgid").(int))
-			   
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutUpdate)
+	defer cancel()
+	vm_id, _ := strconv.Atoi(d.Id())
+
+	// changes are recorded in the state only once they are applied, so that the change that
+	// failed to apply is planned again on the next run
+	d.Partial(true)
+
+	if d.HasChange("name") || d.HasChange("description") {
+		log.Printf("resourceVmUpdate: updating name and description of VM ID %d", vm_id)
+		err := controller.api.Machines.Update(ctx, vm_id, d.Get("name").(string), d.Get("description").(string))
+		if err != nil {
+			return explainAPIError(err, fmt.Sprintf("update name and description of VM ID %d", vm_id))
+		}
+		d.SetPartial("name")
+		d.SetPartial("description")
+	}
+
+	if d.HasChange("cpu") || d.HasChange("ram") {
+		log.Printf("resourceVmUpdate: resizing VM ID %d", vm_id)
+		err := controller.utilityVmResize(ctx, vm_id, d.Get("cpu").(int), d.Get("ram").(int), 
+		                                  d.Get("allow_stop_for_update").(bool))
+		if err != nil {
+			return err
+		}
+		d.SetPartial("cpu")
+		d.SetPartial("ram")
+	}
+
+	if d.HasChange("data_disks") {
+		old_value, new_value := d.GetChange("data_disks")
+		added, removed, grown, err := diffDataDisks(old_value.([]interface{}), new_value.([]interface{}))
+		if err != nil {
+			return err
+		}
+		log.Printf("resourceVmUpdate: data disks of VM ID %d: %d to add, %d to remove, %d to grow", 
+		           vm_id, len(added), len(removed), len(grown))
+		machine := &MachineConfig{
+			ID:         vm_id,
+			Name:       d.Get("name").(string),
+			ResGroupID: d.Get("rgid").(int),
+			DataDisks:  added,
+		}
+		err = controller.utilityVmDisksUpdate(ctx, machine, removed, grown)
+		if err != nil {
+			return err
+		}
+		d.SetPartial("data_disks")
+	}
+
+	if d.HasChange("port_forwards") {
+		machine := &MachineConfig{
+			ID:         vm_id,
+			Name:       d.Get("name").(string),
+			ResGroupID: d.Get("rgid").(int),
+		}
+		machine.PortForwards, _ = makePortforwardsConfig(d.Get("port_forwards").(*schema.Set).List())
+		log.Printf("resourceVmUpdate: reconciling %d port forwards of VM ID %d", len(machine.PortForwards), vm_id)
+		err := controller.utilityVmPortforwardsReconcile(ctx, machine)
+		if err != nil {
+			return err
+		}
+		d.SetPartial("port_forwards")
+	}
+
+	d.Partial(false)
 	return resourceVmRead(d, m)
 }
 
@@ -297,21 +391,28 @@ func resourceVmDelete(d *schema.ResourceData, m interface{}) error {
 	log.Printf("resourceVmDelete: called for VM name %q, ResGroupID %d", 
 	           d.Get("name").(string), d.Get("rgid").(int))
 			   
-	vm_facts, err := utilityVmCheckPresence(d, m)
-	if vm_facts == "" {
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutDelete)
+	defer cancel()
+
+	vm_facts, err := utilityVmCheckPresence(ctx, d, m)
+	if vm_facts == nil {
+		if err != nil {
+			return explainAPIError(err, fmt.Sprintf("look up VM %q", d.Get("name").(string)))
+		}
 		// the target VM does not exist - in this case according to Terraform best practice 
 		// we exit from Destroy method without error
 		return nil
 	}
 
-	params := &url.Values{}
-	params.Add("machineId", d.Id())
-	params.Add("permanently", "true")
-
-	controller := m.(*ControllerCfg)
-	vm_facts, err = controller.decsAPICall("POST", MachineDeleteAPI, params)
+	err = controller.api.Machines.Delete(ctx, int(vm_facts.ID), true)
 	if err != nil {
-		return err
+		if isNotFoundError(err) {
+			// VM has disappeared after we checked for its presence, which is just as good
+			log.Printf("resourceVmDelete: VM ID %s is already gone", d.Id())
+			return nil
+		}
+		return explainAPIError(err, fmt.Sprintf("delete VM ID %s", d.Id()))
 	}
 
 	return nil
@@ -321,9 +422,12 @@ func resourceVmExists(d *schema.ResourceData, m interface{}) (bool, error) {
 	// Reminder: according to Terraform rules, this function should not modify its ResourceData argument
 	log.Printf("resourceVmExist: called for VM name %q, ResGroupID %d", 
 			   d.Get("name").(string), d.Get("rgid").(int))
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutRead)
+	defer cancel()
 			   
-	vm_facts, err := utilityVmCheckPresence(d, m)
-	if vm_facts == "" {
+	vm_facts, err := utilityVmCheckPresence(ctx, d, m)
+	if vm_facts == nil {
 		if err != nil {
 			return false, err
 		}
@@ -332,9 +436,97 @@ func resourceVmExists(d *schema.ResourceData, m interface{}) (bool, error) {
 	return true, nil
 }
 
+func resourceVmImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	// VM can be imported either by its ID or by "<resource group ID>/<VM name>"
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.operationContext(d, schema.TimeoutRead)
+	defer cancel()
+
+	var vm_facts *client.MachinesGetResp
+	var err error
+	if pos := strings.Index(d.Id(), "/"); pos >= 0 {
+		rgid, conv_err := strconv.Atoi(d.Id()[:pos])
+		if conv_err != nil {
+			return nil, fmt.Errorf("Cannot import VM %q: invalid resource group ID %q.", d.Id(), d.Id()[:pos])
+		}
+		vm_facts, err = utilityVmFindByName(ctx, rgid, d.Id()[pos+1:], m)
+	} else {
+		vm_id, conv_err := strconv.Atoi(d.Id())
+		if conv_err != nil {
+			return nil, fmt.Errorf("Cannot import VM %q: expected VM ID or <resource group ID>/<VM name>.", d.Id())
+		}
+		vm_facts, err = utilityVmGetByID(ctx, vm_id, m)
+	}
+	if err != nil {
+		return nil, explainAPIError(err, fmt.Sprintf("import VM %q", d.Id()))
+	}
+	if vm_facts == nil {
+		return nil, fmt.Errorf("Cannot import VM %q: no such VM found.", d.Id())
+	}
+
+	d.SetId(strconv.Itoa(int(vm_facts.ID)))
+	d.Set("rgid", vm_facts.ResGroupID)
+	d.Set("allow_stop_for_update", false)
+	return []*schema.ResourceData{d}, nil
+}
+
+// VM subresources that can only be provisioned if DECS controller has the corresponding capability
+var vmSubresourceCapabilities = []struct{ key string; capability string }{
+	{"data_disks", CAP_DATA_DISKS},
+	{"port_forwards", CAP_PORTFORWARDING},
+	{"networks", CAP_EXTERNAL_NETWORKS},
+}
+
+func subresourceCount(value interface{}) int {
+	// Subresources are kept either in a list or in a set
+	if set, ok := value.(*schema.Set); ok {
+		return set.Len()
+	}
+	return len(value.([]interface{}))
+}
+
+func resourceVmCustomizeDiff(d *schema.ResourceDiff, m interface{}) error {
+	// Reject at plan time VM configuration that DECS controller is not capable of provisioning
+	controller := m.(*ControllerCfg)
+	ctx, cancel := controller.planContext()
+	defer cancel()
+
+	if d.Id() != "" && (d.HasChange("cpu") || d.HasChange("ram")) {
+		err := controller.requireCapability(ctx, CAP_VM_RESIZE)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("data_disks") && d.NewValueKnown("data_disks") {
+		old_value, new_value := d.GetChange("data_disks")
+		_, _, grown, err := diffDataDisks(old_value.([]interface{}), new_value.([]interface{}))
+		if err != nil {
+			return err
+		}
+		if len(grown) > 0 {
+			err = controller.requireCapability(ctx, CAP_DISK_RESIZE)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, item := range vmSubresourceCapabilities {
+		if d.HasChange(item.key) && subresourceCount(d.Get(item.key)) > 0 {
+			err := controller.requireCapability(ctx, item.capability)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func resourceVm() *schema.Resource {
-	return &schema.Resource {
-		SchemaVersion: 1,
+	vm_resource := &schema.Resource {
+		// version 2 keeps port forwards in a set rather than in a list
+		SchemaVersion: 2,
 
 		Create: resourceVmCreate,
 		Read:   resourceVmRead,
@@ -342,6 +534,12 @@ func resourceVm() *schema.Resource {
 		Delete: resourceVmDelete,
 		Exists:  resourceVmExists,
 
+		Importer: &schema.ResourceImporter{
+			State: resourceVmImport,
+		},
+
+		CustomizeDiff: resourceVmCustomizeDiff,
+
 		Timeouts: &schema.ResourceTimeout {
 			Create:  &Timeout180s,
 			Read:    &Timeout30s,
@@ -360,6 +558,7 @@ func resourceVm() *schema.Resource {
 			"rgid": {
 				Type:         schema.TypeInt,
 				Required:     true,
+				ForceNew:     true,
 				ValidateFunc: validation.IntAtLeast(1),
 				Description:  "ID of the resource group where this virtual machine should be deployed.",
 			},
@@ -378,6 +577,13 @@ func resourceVm() *schema.Resource {
 				Description:  "Amount of RAM in MB to allocate to this virtual machine.",
 			},
 
+			"allow_stop_for_update": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Allow the provider to stop and restart this virtual machine if DECS controller cannot change its CPU and RAM while it is running.",
+			},
+
 			"image_id": {
 				Type:        schema.TypeInt,
 				Required:    true,
@@ -400,7 +606,7 @@ func resourceVm() *schema.Resource {
 				Optional:    true,
 				MaxItems:    12,
 				Elem:        &schema.Resource {
-					Schema:  diskSubresourceSchema(),
+					Schema:  dataDiskSubresourceSchema(),
 				},
 				Description: "Specification for data disks on this virtual machine.",
 			},
@@ -445,7 +651,8 @@ func resourceVm() *schema.Resource {
 			},
 
 			"port_forwards": {
-				Type:        schema.TypeList,
+				Type:        schema.TypeSet,
+				Set:         portforwardHash,
 				Optional:    true,
 				MaxItems:    12,
 				Elem:        &schema.Resource {
@@ -475,4 +682,12 @@ func resourceVm() *schema.Resource {
 
 		},
 	}
+	vm_resource.StateUpgraders = []schema.StateUpgrader{
+		{
+			Version: 1,
+			Type:    resourceVmV1(vm_resource.Schema).CoreConfigSchema().ImpliedType(),
+			Upgrade: resourceVmStateUpgradeV1,
+		},
+	}
+	return vm_resource
 }
\ No newline at end of file
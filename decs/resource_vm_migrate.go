@@ -0,0 +1,64 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+
+)
+
+func resourceVmV1(current map[string]*schema.Schema) *schema.Resource {
+	// Schema version 1 of decs_vm differs from the current one only in port_forwards, which was a list.
+	// It is used to read the state saved by the earlier provider releases, including the legacy
+	// flatmap state with list indexes in the port_forwards.N.* keys.
+	v1_schema := make(map[string]*schema.Schema, len(current))
+	for key, value := range current {
+		v1_schema[key] = value
+	}
+	v1_schema["port_forwards"] = &schema.Schema {
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 12,
+		Elem:     &schema.Resource {
+			Schema: portforwardSubresourceSchema(),
+		},
+	}
+	return &schema.Resource{Schema: v1_schema}
+}
+
+func resourceVmStateUpgradeV1(raw_state map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	// Port forwards of version 1 state are read as a list and then put into the set, where each rule
+	// gets the hash of its ports and protocol instead of the list index. Protocol is brought to lower
+	// case, as the current schema keeps it, so that upgrade does not show up as a change in the plan.
+	rules, _ := raw_state["port_forwards"].([]interface{})
+	for _, value := range rules {
+		rule, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if proto, ok := rule["proto"].(string); ok {
+			rule["proto"] = strings.ToLower(proto)
+		}
+	}
+	log.Printf("resourceVmStateUpgradeV1: %d port forwards of VM ID %v moved from list to set", len(rules), raw_state["id"])
+	return raw_state, nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/configs/hcl2shim"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestResourceVmStateUpgradeV1(t *testing.T) {
+	vm_resource := resourceVm()
+	if len(vm_resource.StateUpgraders) != 1 || vm_resource.StateUpgraders[0].Version != vm_resource.SchemaVersion - 1 {
+		t.Fatalf("Expected single state upgrader to schema version %d.", vm_resource.SchemaVersion)
+	}
+	upgrader := vm_resource.StateUpgraders[0]
+
+	// version 1 state saved in the legacy flatmap format keeps port forwards under list indexes
+	v1_state := map[string]string{
+		"id":                       "1001",
+		"name":                     "tf-acc-vm",
+		"rgid":                     "7",
+		"cpu":                      "2",
+		"ram":                      "2048",
+		"image_id":                 "100",
+		"port_forwards.#":          "2",
+		"port_forwards.0.ext_port": "2222",
+		"port_forwards.0.int_port": "22",
+		"port_forwards.0.proto":    "TCP",
+		"port_forwards.0.ext_ip":   "10.1.0.5",
+		"port_forwards.1.ext_port": "5353",
+		"port_forwards.1.int_port": "53",
+		"port_forwards.1.proto":    "udp",
+		"port_forwards.1.ext_ip":   "10.1.0.5",
+	}
+
+	// upgrade the state the way the SDK does for decs_vm of schema version 1
+	v1_value, err := hcl2shim.HCL2ValueFromFlatmap(v1_state, upgrader.Type)
+	if err != nil {
+		t.Fatalf("Cannot read version 1 state: %s", err)
+	}
+	json_state, err := schema.StateValueToJSONMap(v1_value, upgrader.Type)
+	if err != nil {
+		t.Fatalf("Cannot convert version 1 state to JSON: %s", err)
+	}
+	json_state, err = upgrader.Upgrade(json_state, nil)
+	if err != nil {
+		t.Fatalf("Cannot upgrade version 1 state: %s", err)
+	}
+	value, err := schema.JSONMapToStateValue(json_state, vm_resource.CoreConfigSchema())
+	if err != nil {
+		t.Fatalf("Cannot read upgraded state with the current schema: %s", err)
+	}
+	state, err := vm_resource.ShimInstanceStateFromValue(value)
+	if err != nil {
+		t.Fatalf("Cannot make instance state of the upgraded state: %s", err)
+	}
+
+	expected := map[string]string{
+		"port_forwards.#": "2",
+		"rgid":            "7",
+	}
+	for _, rule := range []struct {
+		ext_port int
+		int_port int
+		proto string
+	}{
+		{2222, 22, "tcp"},
+		{5353, 53, "udp"},
+	} {
+		hash := portforwardHash(map[string]interface{}{"ext_port": rule.ext_port, "int_port": rule.int_port, "proto": rule.proto})
+		expected[fmt.Sprintf("port_forwards.%d.ext_port", hash)] = fmt.Sprintf("%d", rule.ext_port)
+		expected[fmt.Sprintf("port_forwards.%d.int_port", hash)] = fmt.Sprintf("%d", rule.int_port)
+		expected[fmt.Sprintf("port_forwards.%d.proto", hash)] = rule.proto
+		expected[fmt.Sprintf("port_forwards.%d.ext_ip", hash)] = "10.1.0.5"
+	}
+	for key, expected_value := range expected {
+		if state.Attributes[key] != expected_value {
+			t.Errorf("Upgraded state has %q = %q, expected %q.", key, state.Attributes[key], expected_value)
+		}
+	}
+	for key := range state.Attributes {
+		if strings.HasPrefix(key, "port_forwards.0.") || strings.HasPrefix(key, "port_forwards.1.") {
+			t.Errorf("Upgraded state still has list indexed key %q.", key)
+		}
+	}
+}
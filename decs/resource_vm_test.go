@@ -0,0 +1,808 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+
+	"github.com/terraform-provider-decs/decs/client"
+)
+
+const testAccVmConfig = `
+resource "decs_resgroup" "rg" {
+  name     = "tf-acc-rg"
+  tenant   = %q
+  location = "fake-location"
+  quotas {
+    cpu = 8
+  }
+}
+
+resource "decs_vm" "vm" {
+  name        = "tf-acc-vm"
+  rgid        = decs_resgroup.rg.id
+  cpu         = 2
+  ram         = 2048
+  image_id    = %d
+  description = "acceptance test VM"
+
+  boot_disk {
+    label = "boot"
+    size  = 20
+  }
+
+  data_disks {
+    label = "data01"
+    size  = 50
+  }
+
+  networks {
+    network_id = %d
+  }
+
+  port_forwards {
+    ext_port = 2222
+    int_port = 22
+    proto    = "tcp"
+  }
+}
+`
+
+func testAccCheckVmProvisioned(fc *fakeController, name string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		vm := fc.findMachine(name)
+		if vm == nil {
+			return fmt.Errorf("VM %q not found in fake DECS controller.", name)
+		}
+		data_disks := 0
+		for _, disk := range vm.DataDisks {
+			if disk.DiskType == "D" {
+				data_disks += 1
+			}
+		}
+		if data_disks != 1 {
+			return fmt.Errorf("VM %q has %d data disks attached, expected 1.", name, data_disks)
+		}
+		if rules := fc.machinePortforwards(int(vm.ID)); len(rules) != 1 {
+			return fmt.Errorf("VM %q has %d port forwards, expected 1.", name, len(rules))
+		}
+		return nil
+	}
+}
+
+func testAccCheckVmPortforwardAttr(name string, ext_port int, int_port int, proto string, key string, value string) resource.TestCheckFunc {
+	// Port forwards are kept in a set, so the rule is addressed by the hash of its ports and protocol
+	hash := portforwardHash(map[string]interface{}{"ext_port": ext_port, "int_port": int_port, "proto": proto})
+	return resource.TestCheckResourceAttr(name, fmt.Sprintf("port_forwards.%d.%s", hash, key), value)
+}
+
+func TestAccVm(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigOAuth2(fc) + fmt.Sprintf(testAccVmConfig, fakeTenantName, fakeImageID, fakeExtNetID),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("decs_vm.vm", "id"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "cpu", "2"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "ram", "2048"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "boot_disk.0.size", "20"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "data_disks.#", "1"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "data_disks.0.size", "50"),
+					resource.TestCheckResourceAttrSet("decs_vm.vm", "data_disks.0.disk_id"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "networks.0.network_id", fmt.Sprintf("%d", fakeExtNetID)),
+					testAccCheckVmPortforwardAttr("decs_vm.vm", 2222, 22, "tcp", "ext_port", "2222"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "user", "user"),
+					resource.TestCheckResourceAttrSet("decs_vm.vm", "password"),
+					testAccCheckVmProvisioned(fc, "tf-acc-vm"),
+				),
+			},
+		},
+	})
+}
+
+func testAccSetStatusPollInterval(interval time.Duration) func() {
+	// Shorten delay between status checks and return function that restores it
+	saved_interval := statusPollInterval
+	statusPollInterval = interval
+	return func() { statusPollInterval = saved_interval }
+}
+
+func TestAccVmWaitForStatus(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	defer testAccSetStatusPollInterval(time.Millisecond * 10)()
+	// disks and networks cannot be attached until the new VM leaves DEPLOYING status
+	fc.settle_gets = 3
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmConfig, fakeTenantName, fakeImageID, fakeExtNetID),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "networks.0.network_id", fmt.Sprintf("%d", fakeExtNetID)),
+					testAccCheckVmProvisioned(fc, "tf-acc-vm"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccVmErrorStatus(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	defer testAccSetStatusPollInterval(time.Millisecond * 10)()
+	fc.settle_gets = 2
+	fc.vm_settle_status = "ERROR"
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config:      testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmConfig, fakeTenantName, fakeImageID, fakeExtNetID),
+				ExpectError: regexp.MustCompile(`VM ID \d+ ended up in ERROR status`),
+			},
+		},
+	})
+}
+
+const testAccVmTimeoutConfig = `
+resource "decs_resgroup" "rg" {
+  name     = "tf-acc-rg"
+  tenant   = %q
+  location = "fake-location"
+  quotas {
+    cpu = 8
+  }
+}
+
+resource "decs_vm" "vm" {
+  name     = "tf-acc-vm"
+  rgid     = decs_resgroup.rg.id
+  cpu      = 2
+  ram      = 2048
+  image_id = %d
+
+  boot_disk {
+    label = "boot"
+    size  = 20
+  }
+
+  data_disks {
+    label = "data01"
+    size  = 50
+  }
+
+  timeouts {
+    create = "1s"
+  }
+}
+`
+
+func TestAccVmCreateTimeout(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	fc.hang(client.DiskCreateAPI)
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config:      testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmTimeoutConfig, fakeTenantName, fakeImageID),
+				ExpectError: regexp.MustCompile(`Timed out while trying to create data disk "data01" \(1 of 1\) for VM ID \d+`),
+			},
+		},
+	})
+}
+
+const testAccVmResizeConfig = `
+resource "decs_resgroup" "rg" {
+  name     = "tf-acc-rg"
+  tenant   = %q
+  location = "fake-location"
+  quotas {
+    cpu = 8
+  }
+}
+
+resource "decs_vm" "vm" {
+  name     = "tf-acc-vm"
+  rgid     = decs_resgroup.rg.id
+  cpu      = %d
+  ram      = %d
+  image_id = %d
+
+  allow_stop_for_update = %t
+
+  boot_disk {
+    label = "boot"
+    size  = 20
+  }
+}
+`
+
+func testAccCheckVmSize(fc *fakeController, name string, cpu int, ram int, status string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		vm := fc.findMachine(name)
+		if vm == nil {
+			return fmt.Errorf("VM %q not found in fake DECS controller.", name)
+		}
+		if vm.Cpu != cpu || vm.Ram != ram {
+			return fmt.Errorf("VM %q has %d CPU and %d MB RAM, expected %d CPU and %d MB RAM.", name, vm.Cpu, vm.Ram, cpu, ram)
+		}
+		if vm.Status != status {
+			return fmt.Errorf("VM %q is in status %s, expected %s.", name, vm.Status, status)
+		}
+		return nil
+	}
+}
+
+func TestAccVmResize(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmResizeConfig, fakeTenantName, 2, 2048, fakeImageID, false),
+				Check:  testAccCheckVmSize(fc, "tf-acc-vm", 2, 2048, "RUNNING"),
+			},
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmResizeConfig, fakeTenantName, 4, 4096, fakeImageID, false),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "cpu", "4"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "ram", "4096"),
+					testAccCheckVmSize(fc, "tf-acc-vm", 4, 4096, "RUNNING"),
+				),
+			},
+		},
+	})
+
+	if count := fc.callCount(client.MachineStopAPI); count != 0 {
+		t.Errorf("VM was stopped %d times for resize that did not need it.", count)
+	}
+}
+
+func TestAccVmResizeRequiresStop(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	defer testAccSetStatusPollInterval(time.Millisecond * 10)()
+	fc.resize_needs_stop = true
+	// VM keeps its status for a while after stop and start calls return
+	fc.power_gets = 3
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmResizeConfig, fakeTenantName, 2, 2048, fakeImageID, false),
+			},
+			{
+				// VM must not be stopped unless the user allowed it
+				Config:      testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmResizeConfig, fakeTenantName, 4, 4096, fakeImageID, false),
+				ExpectError: regexp.MustCompile(`requires the VM to be stopped for resize. Set allow_stop_for_update = true`),
+			},
+			{
+				// change that failed to apply must still be planned
+				Config:             testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmResizeConfig, fakeTenantName, 4, 4096, fakeImageID, false),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+				Check:              testAccCheckVmSize(fc, "tf-acc-vm", 2, 2048, "RUNNING"),
+			},
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmResizeConfig, fakeTenantName, 4, 4096, fakeImageID, true),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "cpu", "4"),
+					testAccCheckVmSize(fc, "tf-acc-vm", 4, 4096, "RUNNING"),
+				),
+			},
+		},
+	})
+
+	if fc.callCount(client.MachineStopAPI) != 1 || fc.callCount(client.MachineStartAPI) != 1 {
+		t.Errorf("VM was stopped %d and started %d times, expected once each.", 
+		         fc.callCount(client.MachineStopAPI), fc.callCount(client.MachineStartAPI))
+	}
+}
+
+func TestVmResizeDeploying(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	fc.resize_needs_stop = true
+	config := testControllerConfigLegacy(t, fc)
+	rgid := fc.addCloudspace("tf-acc-rg")
+	fc.settle_gets = 3
+	vm_id := fc.addMachine(rgid, "tf-acc-vm", 2, 2048)
+
+	// conflict caused by VM that is still being deployed must not make the provider stop it
+	err := config.utilityVmResize(context.Background(), vm_id, 4, 4096, true)
+	if err == nil || !strings.Contains(err.Error(), "refused to resize VM in status DEPLOYING") {
+		t.Fatalf("Expected resize of deploying VM to fail, got %v", err)
+	}
+	if count := fc.callCount(client.MachineStopAPI); count != 0 {
+		t.Errorf("Deploying VM was stopped %d times for resize.", count)
+	}
+}
+
+const testAccVmRenameConfig = `
+resource "decs_resgroup" "rg" {
+  name     = "tf-acc-rg"
+  tenant   = %q
+  location = "fake-location"
+  quotas {
+    cpu = 8
+  }
+}
+
+resource "decs_vm" "vm" {
+  name        = %q
+  rgid        = decs_resgroup.rg.id
+  cpu         = 2
+  ram         = 2048
+  image_id    = %d
+  description = %q
+
+  boot_disk {
+    label = "boot"
+    size  = 20
+  }
+}
+`
+
+func TestAccVmRename(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	var vm_id string
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmRenameConfig, fakeTenantName, "tf-acc-vm", fakeImageID, "first VM"),
+				Check: func(s *terraform.State) error {
+					vm_id = s.RootModule().Resources["decs_vm.vm"].Primary.ID
+					return nil
+				},
+			},
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmRenameConfig, fakeTenantName, "tf-acc-vm-renamed", fakeImageID, ""),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "name", "tf-acc-vm-renamed"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "description", ""),
+					func(s *terraform.State) error {
+						// VM must be updated in place rather than recreated under the new name
+						if id := s.RootModule().Resources["decs_vm.vm"].Primary.ID; id != vm_id {
+							return fmt.Errorf("VM ID changed from %s to %s after rename.", vm_id, id)
+						}
+						vm := fc.findMachine("tf-acc-vm-renamed")
+						if vm == nil || fmt.Sprintf("%d", vm.ID) != vm_id || vm.Description != "" {
+							return fmt.Errorf("VM ID %s was not renamed in fake DECS controller.", vm_id)
+						}
+						if fc.findMachine("tf-acc-vm") != nil {
+							return fmt.Errorf("VM with the old name is left in fake DECS controller.")
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+
+	if count := fc.callCount(client.MachineCreateAPI); count != 1 {
+		t.Errorf("VM was created %d times, expected once.", count)
+	}
+}
+
+const testAccVmMoveConfig = `
+resource "decs_resgroup" "rg" {
+  count    = 2
+  name     = "tf-acc-rg-${count.index}"
+  tenant   = %q
+  location = "fake-location"
+  quotas {
+    cpu = 8
+  }
+}
+
+resource "decs_vm" "vm" {
+  name     = "tf-acc-vm"
+  rgid     = decs_resgroup.rg[%d].id
+  cpu      = 2
+  ram      = 2048
+  image_id = %d
+
+  boot_disk {
+    label = "boot"
+    size  = 20
+  }
+}
+`
+
+func TestAccVmMove(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	var vm_id string
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmMoveConfig, fakeTenantName, 0, fakeImageID),
+				Check: func(s *terraform.State) error {
+					vm_id = s.RootModule().Resources["decs_vm.vm"].Primary.ID
+					return nil
+				},
+			},
+			{
+				// VM cannot be moved between resource groups, so it is recreated in the new one
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmMoveConfig, fakeTenantName, 1, fakeImageID),
+				Check: func(s *terraform.State) error {
+					if id := s.RootModule().Resources["decs_vm.vm"].Primary.ID; id == vm_id {
+						return fmt.Errorf("VM ID %s was not recreated after change of resource group.", vm_id)
+					}
+					vm := fc.findMachine("tf-acc-vm")
+					rg := fc.findCloudspace("tf-acc-rg-1")
+					if vm == nil || rg == nil || vm.ResGroupID != rg.ID {
+						return fmt.Errorf("VM is not in resource group tf-acc-rg-1 in fake DECS controller.")
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestAccVmImport(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmResizeConfig, fakeTenantName, 2, 2048, fakeImageID, false),
+			},
+			{
+				Config:            testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmResizeConfig, fakeTenantName, 2, 2048, fakeImageID, false),
+				ResourceName:      "decs_vm.vm",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				Config:            testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmResizeConfig, fakeTenantName, 2, 2048, fakeImageID, false),
+				ResourceName:      "decs_vm.vm",
+				ImportState:       true,
+				ImportStateIdFunc: func(s *terraform.State) (string, error) {
+					return s.RootModule().Resources["decs_resgroup.rg"].Primary.ID + "/tf-acc-vm", nil
+				},
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+const testAccVmDisksConfig = `
+resource "decs_resgroup" "rg" {
+  name     = "tf-acc-rg"
+  tenant   = %q
+  location = "fake-location"
+  quotas {
+    cpu = 8
+  }
+}
+
+resource "decs_vm" "vm" {
+  name     = "tf-acc-vm"
+  rgid     = decs_resgroup.rg.id
+  cpu      = 2
+  ram      = 2048
+  image_id = %d
+
+  boot_disk {
+    label = "boot"
+    size  = 20
+  }
+%s
+}
+`
+
+func testAccVmDisks(disks ...string) string {
+	// Make data_disks blocks from "label:size" specifications, optionally followed by ":keep" or by
+	// ":key=value" for other disk settings, e.g. "data01:10:pool=fast"
+	var blocks []string
+	for _, disk := range disks {
+		parts := strings.Split(disk, ":")
+		block := fmt.Sprintf("\n  data_disks {\n    label = %q\n    size  = %s\n", parts[0], parts[1])
+		for _, option := range parts[2:] {
+			if option == "keep" {
+				block += "    keep_on_remove = true\n"
+				continue
+			}
+			setting := strings.SplitN(option, "=", 2)
+			block += fmt.Sprintf("    %s = %q\n", setting[0], setting[1])
+		}
+		blocks = append(blocks, block + "  }\n")
+	}
+	return strings.Join(blocks, "")
+}
+
+func testAccCheckVmDataDisks(fc *fakeController, name string, disks map[string]int) resource.TestCheckFunc {
+	// Check labels and sizes of the data disks attached to the VM in the fake controller
+	return func(s *terraform.State) error {
+		vm := fc.findMachine(name)
+		if vm == nil {
+			return fmt.Errorf("VM %q not found in fake DECS controller.", name)
+		}
+		attached := make(map[string]int)
+		for _, disk := range vm.DataDisks {
+			if disk.DiskType == "D" {
+				attached[disk.Label] = disk.SizeMax
+			}
+		}
+		if !reflect.DeepEqual(attached, disks) {
+			return fmt.Errorf("VM %q has data disks %v attached, expected %v.", name, attached, disks)
+		}
+		return nil
+	}
+}
+
+func TestAccVmDataDisksUpdate(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := func(disks ...string) string {
+		return testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmDisksConfig, fakeTenantName, fakeImageID, testAccVmDisks(disks...))
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders(),
+		CheckDestroy: func(s *terraform.State) error {
+			// the disk that was kept on removal is the only object left
+			if count := fc.diskCount(); count != 1 || fc.objectCount() != 1 {
+				return fmt.Errorf("%d objects including %d disks left in fake DECS controller after destroy, expected 1 disk.", 
+				                  fc.objectCount(), count)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: config("data01:10", "data02:20:keep"),
+				Check:  testAccCheckVmDataDisks(fc, "tf-acc-vm", map[string]int{"data01": 10, "data02": 20}),
+			},
+			{
+				// add a disk and grow existing one
+				Config: config("data01:15", "data02:20:keep", "data03:30"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "data_disks.#", "3"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "data_disks.0.size", "15"),
+					resource.TestCheckResourceAttr("decs_vm.vm", "data_disks.2.label", "data03"),
+					testAccCheckVmDataDisks(fc, "tf-acc-vm", map[string]int{"data01": 15, "data02": 20, "data03": 30}),
+				),
+			},
+			{
+				// removed disks are deleted unless they are to be kept
+				Config: config("data03:30"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "data_disks.#", "1"),
+					testAccCheckVmDataDisks(fc, "tf-acc-vm", map[string]int{"data03": 30}),
+					func(s *terraform.State) error {
+						// data03 and detached data02
+						if count := fc.diskCount(); count != 2 {
+							return fmt.Errorf("Fake DECS controller has %d disks, expected 2.", count)
+						}
+						return nil
+					},
+				),
+			},
+			{
+				Config:      config("data03:20"),
+				ExpectError: regexp.MustCompile(`Cannot shrink data disk "data03" from 30 GB to 20 GB`),
+			},
+			{
+				Config:      config("data03:30", "data03:40"),
+				ExpectError: regexp.MustCompile(`Duplicate data disk label "data03"`),
+			},
+			{
+				// pool and provider of the new disk are kept as configured, as the controller does not report them
+				Config: config("data03:30", "data04:10:pool=fast"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "data_disks.1.pool", "fast"),
+					testAccCheckVmDataDisks(fc, "tf-acc-vm", map[string]int{"data03": 30, "data04": 10}),
+				),
+			},
+			{
+				Config:      config("data03:30", "data04:10:pool=slow"),
+				ExpectError: regexp.MustCompile(`Cannot change pool of data disk "data04" from "fast" to "slow"`),
+			},
+			{
+				Config:      config("data03:30:provider=other", "data04:10:pool=fast"),
+				ExpectError: regexp.MustCompile(`Cannot change provider of data disk "data03" from "default" to "other"`),
+			},
+		},
+	})
+}
+
+const testAccVmPortforwardsConfig = `
+resource "decs_resgroup" "rg" {
+  name     = "tf-acc-rg"
+  tenant   = %q
+  location = "fake-location"
+  quotas {
+    cpu = 8
+  }
+}
+
+resource "decs_vm" "vm" {
+  name     = "tf-acc-vm"
+  rgid     = decs_resgroup.rg.id
+  cpu      = 2
+  ram      = 2048
+  image_id = %d
+
+  boot_disk {
+    label = "boot"
+    size  = 20
+  }
+%s
+}
+`
+
+func testAccVmPortforwards(rules ...string) string {
+	// Make port_forwards blocks from "ext_port:int_port/proto" specifications
+	var blocks []string
+	for _, rule := range rules {
+		var ext_port, int_port int
+		var proto string
+		fmt.Sscanf(strings.Replace(rule, "/", " ", 1), "%d:%d %s", &ext_port, &int_port, &proto)
+		blocks = append(blocks, fmt.Sprintf("\n  port_forwards {\n    ext_port = %d\n    int_port = %d\n    proto    = %q\n  }\n", 
+		                                     ext_port, int_port, proto))
+	}
+	return strings.Join(blocks, "")
+}
+
+func testAccCheckVmPortforwards(fc *fakeController, name string, rules ...string) resource.TestCheckFunc {
+	// Check that port forwards of the VM in the fake controller are exactly the specified ones
+	return func(s *terraform.State) error {
+		vm := fc.findMachine(name)
+		if vm == nil {
+			return fmt.Errorf("VM %q not found in fake DECS controller.", name)
+		}
+		var actual []string
+		for _, record := range fc.machinePortforwards(int(vm.ID)) {
+			actual = append(actual, fmt.Sprintf("%s:%s/%s", record.ExtPort, record.IntPort, record.Proto))
+		}
+		sort.Strings(actual)
+		sort.Strings(rules)
+		if strings.Join(actual, ",") != strings.Join(rules, ",") {
+			return fmt.Errorf("VM %q has port forwards %v, expected %v.", name, actual, rules)
+		}
+		return nil
+	}
+}
+
+func TestAccVmPortforwardsUpdate(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := func(rules ...string) string {
+		return testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmPortforwardsConfig, fakeTenantName, fakeImageID, testAccVmPortforwards(rules...))
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config: config("2222:22/tcp", "8080:80/tcp"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "port_forwards.#", "2"),
+					testAccCheckVmPortforwardAttr("decs_vm.vm", 8080, 80, "tcp", "int_port", "80"),
+					testAccCheckVmPortforwards(fc, "tf-acc-vm", "2222:22/tcp", "8080:80/tcp"),
+				),
+			},
+			{
+				// one rule replaced, the other left intact
+				Config: config("2222:22/tcp", "8443:443/tcp"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "port_forwards.#", "2"),
+					testAccCheckVmPortforwardAttr("decs_vm.vm", 8443, 443, "tcp", "ext_port", "8443"),
+					testAccCheckVmPortforwards(fc, "tf-acc-vm", "2222:22/tcp", "8443:443/tcp"),
+				),
+			},
+			{
+				// rule deleted outside of Terraform is planned to be created again
+				PreConfig:          func() { fc.removePortforward(8443) },
+				Config:             config("2222:22/tcp", "8443:443/tcp"),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: config("2222:22/tcp", "8443:443/tcp"),
+				Check:  testAccCheckVmPortforwards(fc, "tf-acc-vm", "2222:22/tcp", "8443:443/tcp"),
+			},
+			{
+				Config: config(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("decs_vm.vm", "port_forwards.#", "0"),
+					testAccCheckVmPortforwards(fc, "tf-acc-vm"),
+				),
+			},
+		},
+	})
+
+	if count := fc.callCount(client.PortforwardingDeleteAPI); count != 3 {
+		t.Errorf("Port forwarding delete API was called %d times, expected 3.", count)
+	}
+}
+
+func TestAccVmPortforwardsProtoCase(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	// protocol is reported in upper case whatever case it was set in
+	fc.upper_proto = true
+	config := func(rules ...string) string {
+		return testAccProviderConfigLegacy(fc) + fmt.Sprintf(testAccVmPortforwardsConfig, fakeTenantName, fakeImageID, testAccVmPortforwards(rules...))
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders(),
+		CheckDestroy: testAccCheckFakeEmpty(fc),
+		Steps: []resource.TestStep{
+			{
+				Config:      config("2222:22/icmp"),
+				ExpectError: regexp.MustCompile(`expected port_forwards.\d+.proto to be one of \[tcp udp\]`),
+			},
+			{
+				// the plan must be empty after apply in spite of the case difference
+				Config: config("2222:22/tcp", "5353:53/UDP"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckVmPortforwardAttr("decs_vm.vm", 2222, 22, "tcp", "proto", "tcp"),
+					testAccCheckVmPortforwardAttr("decs_vm.vm", 5353, 53, "udp", "proto", "udp"),
+					testAccCheckVmPortforwards(fc, "tf-acc-vm", "2222:22/tcp", "5353:53/udp"),
+				),
+			},
+			{
+				Config:   config("2222:22/TCP", "5353:53/udp"),
+				PlanOnly: true,
+			},
+		},
+	})
+}
@@ -0,0 +1,92 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"context"
+	"sync"
+	"time"
+
+)
+
+// API call that had to wait longer than this for its turn is reported in the log
+var throttleWaitLogThreshold = time.Second
+
+// API call that took longer than this to complete is reported in the log
+var slowCallLogThreshold = time.Second * 10
+
+// apiThrottle limits the number of API requests running concurrently against DECS controller
+// and the rate at which new requests are started. It is shared by all resources handled by
+// the provider instance.
+type apiThrottle struct {
+	slots chan struct{}        // semaphore for concurrent requests, nil if not limited
+	interval time.Duration     // minimum interval between starts of two requests, 0 if not limited
+	mutex sync.Mutex
+	next_start time.Time       // earliest time the next request is allowed to start
+}
+
+func newAPIThrottle(max_concurrent int, requests_per_second float64) *apiThrottle {
+	throttle := &apiThrottle{}
+	if max_concurrent > 0 {
+		throttle.slots = make(chan struct{}, max_concurrent)
+	}
+	if requests_per_second > 0 {
+		throttle.interval = time.Duration(float64(time.Second) / requests_per_second)
+	}
+	return throttle
+}
+
+func (throttle *apiThrottle) acquire(ctx context.Context) (time.Duration, error) {
+	// Wait until the request is allowed to start and return the time spent waiting. Waiting is
+	// abandoned once the context is done. Each successful acquire() must be paired with release().
+	started := time.Now()
+
+	if throttle.slots != nil {
+		select {
+		case throttle.slots <- struct{}{}:
+		case <-ctx.Done():
+			return time.Since(started), ctx.Err()
+		}
+	}
+
+	if throttle.interval > 0 {
+		// reserve the earliest available start time and then sleep until it comes
+		throttle.mutex.Lock()
+		now := time.Now()
+		start := throttle.next_start
+		if start.Before(now) {
+			start = now
+		}
+		throttle.next_start = start.Add(throttle.interval)
+		throttle.mutex.Unlock()
+		err := sleepContext(ctx, time.Until(start))
+		if err != nil {
+			throttle.release()
+			return time.Since(started), err
+		}
+	}
+
+	return time.Since(started), nil
+}
+
+func (throttle *apiThrottle) release() {
+	if throttle.slots != nil {
+		<-throttle.slots
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"bytes"
+	"context"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/terraform-provider-decs/decs/client"
+)
+
+func testControllerConfigThrottled(t *testing.T, fc *fakeController, max_concurrent int, requests_per_second float64) *ControllerCfg {
+	return testControllerConfig(t, map[string]interface{}{
+		"authenticator":           "legacy",
+		"controller_url":          fc.URL(),
+		"user":                    fakeLegacyUser,
+		"password":                fakeLegacyPassword,
+		"max_retries":             0,
+		"disable_cache":           true,
+		"max_concurrent_requests": max_concurrent,
+		"requests_per_second":     requests_per_second,
+	})
+}
+
+func TestThrottleRate(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := testControllerConfigThrottled(t, fc, 0, 20)
+	testListImages(t, config)
+
+	// 10 more requests at 20 per second cannot complete faster than 10 intervals of 50ms
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := config.decsAPICall(context.Background(), "POST", client.ImagesListAPI, &url.Values{}); err != nil {
+				t.Errorf("API call failed: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(started); elapsed < time.Millisecond * 450 {
+		t.Errorf("10 requests took %s, expected rate limit of 20 requests per second to be applied.", elapsed)
+	}
+}
+
+func TestThrottleConcurrency(t *testing.T) {
+	throttle := newAPIThrottle(2, 0)
+	for i := 0; i < 2; i++ {
+		if _, err := throttle.acquire(context.Background()); err != nil {
+			t.Fatalf("Failed to acquire free slot: %s", err)
+		}
+	}
+
+	// third request waits for a free slot until its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond * 50)
+	defer cancel()
+	if _, err := throttle.acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Request beyond concurrency limit was not held back, got %v", err)
+	}
+
+	throttle.release()
+	waited, err := throttle.acquire(context.Background())
+	if err != nil || waited > time.Millisecond * 50 {
+		t.Errorf("Request did not get released slot at once: waited %s, error %v", waited, err)
+	}
+}
+
+func TestThrottleSkipsLogin(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := testControllerConfigThrottled(t, fc, 1, 0)
+
+	// login must not wait for the slot held by the API call that needs the session
+	_, err := config.throttle.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to acquire free slot: %s", err)
+	}
+	defer config.throttle.release()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second * 5)
+	defer cancel()
+	if _, err := config.getCredential(ctx); err != nil {
+		t.Errorf("Login was held back by request limits: %s", err)
+	}
+	if count := fc.callCount("/restmachine/cloudapi/users/authenticate"); count != 1 {
+		t.Errorf("Provider logged in %d times, expected once.", count)
+	}
+}
+
+func TestThrottleDebugLog(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	config := testControllerConfigThrottled(t, fc, 0, 10)
+
+	saved_wait, saved_slow := throttleWaitLogThreshold, slowCallLogThreshold
+	throttleWaitLogThreshold, slowCallLogThreshold = time.Millisecond * 10, 0
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer func() {
+		throttleWaitLogThreshold, slowCallLogThreshold = saved_wait, saved_slow
+		log.SetOutput(os.Stderr)
+	}()
+
+	// the second request has to wait 100ms for its turn
+	testListImages(t, config)
+	testListImages(t, config)
+
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, "sendAPIRequest:") && !strings.Contains(line, "[DEBUG] sendAPIRequest:") {
+			t.Errorf("Throttling log line is not tagged as debug: %s", line)
+		}
+	}
+	for _, part := range []string{"for its turn due to request limits", "to complete"} {
+		if !strings.Contains(buf.String(), part) {
+			t.Errorf("Log output does not report %q:\n%s", part, buf.String())
+		}
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package decs
+
+import (
+
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/logging"
+
+)
+
+// Every exchange with the controller is traced by decsAPICall. At TF_LOG=DEBUG the trace line holds
+// method, API path, redacted parameters, status code, response size and latency of the call. Full
+// response bodies with secrets redacted are logged only at TF_LOG=TRACE.
+//
+// Each Terraform operation (CRUD function of a resource, read of a data source or plan time check)
+// gets a correlation ID, which is carried by the operation context and printed in every trace line,
+// so that API calls of the operations Terraform runs in parallel can be told apart.
+
+type operationIDKey struct{}
+
+func newOperationID() string {
+	buf := make([]byte, 4)
+	_, err := rand.Read(buf)
+	if err != nil {
+		// correlation ID is only used in logs, so it does not have to be random
+		return fmt.Sprintf("%08x", time.Now().UnixNano() & 0xffffffff)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func withOperationID(ctx context.Context) (context.Context, string) {
+	op_id := newOperationID()
+	return context.WithValue(ctx, operationIDKey{}, op_id), op_id
+}
+
+func operationID(ctx context.Context) string {
+	op_id, ok := ctx.Value(operationIDKey{}).(string)
+	if !ok {
+		return "-"
+	}
+	return op_id
+}
+
+func traceBodies() bool {
+	return logging.LogLevel() == "TRACE"
+}
+
+func traceAPICall(ctx context.Context, node_url string, method string, api_name string, url_values *url.Values,
+	              status_code int, resp_body []byte, err error, elapsed time.Duration) {
+	// Log single exchange with the controller and account it in the API call statistics.
+	runStats.record(api_name, elapsed, err != nil || status_code != 200)
+	if err != nil {
+		log.Printf("[DEBUG] decsAPICall: op=%s %s %s%s params=%q error=%q elapsed=%s", 
+		           operationID(ctx), method, node_url, api_name, redactValues(*url_values), err, elapsed)
+		return
+	}
+	log.Printf("[DEBUG] decsAPICall: op=%s %s %s%s params=%q status=%d size=%d elapsed=%s", 
+	           operationID(ctx), method, node_url, api_name, redactValues(*url_values), status_code, len(resp_body), elapsed)
+	if traceBodies() {
+		log.Printf("[TRACE] decsAPICall: op=%s response of %s:\n%s", operationID(ctx), api_name, redactText(string(resp_body)))
+	}
+}
+
+type apiCallStats struct {
+	calls int
+	failures int             // transport errors and responses with status other than 200
+	total time.Duration
+	max time.Duration
+}
+
+type apiStats struct {
+	mutex sync.Mutex
+	apis map[string]*apiCallStats
+	logged sync.Once         // summary is logged once per process
+}
+
+// statistics of API calls made by all provider instances running in this process
+var runStats = &apiStats{apis: make(map[string]*apiCallStats)}
+
+func (stats *apiStats) record(api_name string, elapsed time.Duration, failed bool) {
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	api_stats, ok := stats.apis[api_name]
+	if !ok {
+		api_stats = &apiCallStats{}
+		stats.apis[api_name] = api_stats
+	}
+	api_stats.calls += 1
+	if failed {
+		api_stats.failures += 1
+	}
+	api_stats.total += elapsed
+	if elapsed > api_stats.max {
+		api_stats.max = elapsed
+	}
+}
+
+func (stats *apiStats) summary() string {
+	// Format per-API call counts and latencies, the busiest APIs first. Empty string is returned
+	// if no API calls were made.
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+	if len(stats.apis) == 0 {
+		return ""
+	}
+	api_names := make([]string, 0, len(stats.apis))
+	for api_name := range stats.apis {
+		api_names = append(api_names, api_name)
+	}
+	sort.Slice(api_names, func(i, j int) bool {
+		left, right := stats.apis[api_names[i]], stats.apis[api_names[j]]
+		if left.calls != right.calls {
+			return left.calls > right.calls
+		}
+		return api_names[i] < api_names[j]
+	})
+
+	var lines strings.Builder
+	total_calls := 0
+	var total_time time.Duration
+	for _, api_name := range api_names {
+		api_stats := stats.apis[api_name]
+		total_calls += api_stats.calls
+		total_time += api_stats.total
+		fmt.Fprintf(&lines, "\n  %s: calls=%d failed=%d avg=%s max=%s total=%s", api_name, api_stats.calls, api_stats.failures,
+		            (api_stats.total / time.Duration(api_stats.calls)).Round(time.Millisecond),
+		            api_stats.max.Round(time.Millisecond), api_stats.total.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%d API calls to DECS controller took %s%s", total_calls, total_time.Round(time.Millisecond), lines.String())
+}
+
+// LogAPISummary logs call count and latency of each DECS API called by the provider in this process.
+// The provider logs it when Terraform asks it to stop. As Terraform may instead shut the plugin down
+// at the end of the run, LogAPISummary should also be called once the plugin stops serving Terraform.
+// Only the first call logs the summary.
+func LogAPISummary() {
+	runStats.logSummary()
+}
+
+func (stats *apiStats) logSummary() {
+	stats.logged.Do(func() {
+		summary := stats.summary()
+		if summary != "" {
+			log.Printf("[DEBUG] decs: %s", summary)
+		}
+	})
+}
+
+func logAPISummaryOnStop(stop_ctx context.Context) {
+	// Log API summary when Terraform asks the provider to stop. Terraform may kill the plugin soon after,
+	// before the plugin gets a chance to log the summary on its shutdown.
+	go func() {
+		<-stop_ctx.Done()
+		LogAPISummary()
+	}()
+}
@@ -0,0 +1,177 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+
+package decs
+
+import (
+
+	"bytes"
+	"context"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+
+	"github.com/terraform-provider-decs/decs/client"
+)
+
+func testTraceAPICall(t *testing.T, log_level string) string {
+	// Trace single API call with the given TF_LOG level and return the log output
+	old_level, level_set := os.LookupEnv("TF_LOG")
+	os.Setenv("TF_LOG", log_level)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		if level_set {
+			os.Setenv("TF_LOG", old_level)
+		} else {
+			os.Unsetenv("TF_LOG")
+		}
+	}()
+
+	ctx, op_id := withOperationID(context.Background())
+	values := &url.Values{}
+	values.Set("machineId", "42")
+	values.Set("password", "secret-password")
+	traceAPICall(ctx, "https://ctrl.example.com", "POST", "/restmachine/cloudapi/machines/get", values, 200,
+	             []byte(`{"id": 42, "password": "secret-password"}`), nil, time.Millisecond * 15)
+
+	output := buf.String()
+	if !strings.Contains(output, "op=" + op_id) {
+		t.Errorf("Trace at %s level does not include correlation ID %q:\n%s", log_level, op_id, output)
+	}
+	if strings.Contains(output, "secret-password") {
+		t.Errorf("Trace at %s level includes secret value:\n%s", log_level, output)
+	}
+	return output
+}
+
+func TestTraceAPICall(t *testing.T) {
+	output := testTraceAPICall(t, "DEBUG")
+	for _, part := range []string{"[DEBUG]", "/machines/get", "machineId=42", "status=200", "size=", "elapsed=15ms"} {
+		if !strings.Contains(output, part) {
+			t.Errorf("Trace at DEBUG level does not include %q:\n%s", part, output)
+		}
+	}
+	if strings.Contains(output, "[TRACE]") {
+		t.Errorf("Trace at DEBUG level includes response body:\n%s", output)
+	}
+
+	output = testTraceAPICall(t, "TRACE")
+	if !strings.Contains(output, "[TRACE]") || !strings.Contains(output, `"id": 42`) {
+		t.Errorf("Trace at TRACE level does not include response body:\n%s", output)
+	}
+}
+
+func TestAPIStatsSummary(t *testing.T) {
+	stats := &apiStats{apis: make(map[string]*apiCallStats)}
+	if summary := stats.summary(); summary != "" {
+		t.Errorf("Summary of no API calls is not empty: %q", summary)
+	}
+
+	stats.record("/restmachine/cloudapi/machines/get", time.Millisecond * 10, false)
+	stats.record("/restmachine/cloudapi/machines/get", time.Millisecond * 30, true)
+	stats.record("/restmachine/cloudapi/cloudspaces/list", time.Millisecond * 5, false)
+
+	summary := stats.summary()
+	for _, part := range []string{
+		"3 API calls to DECS controller took 45ms",
+		"/restmachine/cloudapi/machines/get: calls=2 failed=1 avg=20ms max=30ms total=40ms",
+		"/restmachine/cloudapi/cloudspaces/list: calls=1 failed=0 avg=5ms max=5ms total=5ms",
+	} {
+		if !strings.Contains(summary, part) {
+			t.Errorf("Summary does not include %q:\n%s", part, summary)
+		}
+	}
+	if strings.Index(summary, "machines/get") > strings.Index(summary, "cloudspaces/list") {
+		t.Errorf("Summary does not list the busiest API first:\n%s", summary)
+	}
+}
+
+// testLogBuffer collects log output written from other goroutines
+type testLogBuffer struct {
+	mutex sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *testLogBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *testLogBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestAPISummaryLoggedOnStop(t *testing.T) {
+	fc := newFakeController()
+	defer fc.Close()
+	saved_stats := runStats
+	runStats = &apiStats{apis: make(map[string]*apiCallStats)}
+	var buf testLogBuffer
+	log.SetOutput(&buf)
+	defer func() {
+		runStats = saved_stats
+		log.SetOutput(os.Stderr)
+	}()
+
+	provider := Provider()
+	m, err := providerConfigure(schema.TestResourceDataRaw(t, provider.Schema, map[string]interface{}{
+		"authenticator":  "legacy",
+		"controller_url": fc.URL(),
+		"user":           fakeLegacyUser,
+		"password":       fakeLegacyPassword,
+	}), provider)
+	if err != nil {
+		t.Fatalf("Cannot configure provider: %s", err)
+	}
+	testListImages(t, m.(*ControllerCfg))
+	if strings.Contains(buf.String(), "API calls to DECS controller") {
+		t.Fatalf("API summary is logged before the provider is stopped.")
+	}
+
+	err = provider.Stop()
+	if err != nil {
+		t.Fatalf("Cannot stop provider: %s", err)
+	}
+	deadline := time.Now().Add(time.Second * 5)
+	for !strings.Contains(buf.String(), "API calls to DECS controller") {
+		if time.Now().After(deadline) {
+			t.Fatalf("API summary is not logged after the provider is stopped:\n%s", buf.String())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if !strings.Contains(buf.String(), client.ImagesListAPI + ": calls=1") {
+		t.Errorf("API summary does not include the call made:\n%s", buf.String())
+	}
+
+	// summary is not logged again when the plugin shuts down
+	LogAPISummary()
+	if count := strings.Count(buf.String(), "API calls to DECS controller"); count != 1 {
+		t.Errorf("API summary is logged %d times, expected once.", count)
+	}
+}
@@ -19,23 +19,14 @@ package decs
 
 import (
 
-	"strings"
+	"github.com/terraform-provider-decs/decs/client"
 
 )
 
-func Jo2JSON(arg_str string) string {
+func Jo2JSON(arg_str string) (string, error) {
 	// DECS API historically returns response in the form of Python dictionary, which generally
 	// looks like JSON, but does not comply with JSON syntax.
-	// For Golang JSON Unmarshal to work properly we need to pre-process API response as follows:   
-	ret_string := strings.Replace(string(arg_str), "u'", "\"", -1)
-	ret_string = strings.Replace(ret_string, "'", "\"", -1)
-	ret_string = strings.Replace(ret_string, "False", "false", -1)
-	ret_string = strings.Replace(ret_string, "True", "true", -1)
-	ret_string = strings.Replace(ret_string, "null", "\"\"", -1)
-	ret_string = strings.Replace(ret_string, "None", "\"\"", -1)
-
-	// fix for incorrect handling of usage info
-	ret_string = strings.Replace(ret_string, "<", "\"", -1)
-	ret_string = strings.Replace(ret_string, ">", "\"", -1)
-	return ret_string
+	// For Golang JSON Unmarshal to work properly we need to convert API response to JSON. 
+	// Response that is already valid JSON is returned unchanged.
+	return client.PyLiteralToJSON(arg_str)
 }
@@ -19,27 +19,20 @@ package decs
 
 import (
 
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
-	"net/url"
-	// "strconv"
+	"strconv"
+	"strings"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	// "github.com/hashicorp/terraform/helper/validation"
-)
 
-func (ctrl *ControllerCfg) utilityResgroupConfigGet(rgid int) (*ResgroupConfig, error) {
-	url_values := &url.Values{}
-	url_values.Add("cloudspaceId", fmt.Sprintf("%d", rgid))
-	resgroup_facts, err := ctrl.decsAPICall("POST", CloudspacesGetAPI, url_values)
-	if err != nil {
-		return nil, err
-	}
+	"github.com/terraform-provider-decs/decs/client"
+)
 
-	log.Printf("utilityResgroupConfigGet: ready to unmarshal string %q", resgroup_facts)
-	model := CloudspacesGetResp{}
-	err = json.Unmarshal([]byte(resgroup_facts), &model)
+func (ctrl *ControllerCfg) utilityResgroupConfigGet(ctx context.Context, rgid int) (*ResgroupConfig, error) {
+	model, err := ctrl.api.Cloudspaces.Get(ctx, rgid)
 	if err != nil {
 		return nil, err
 	}
@@ -59,73 +52,86 @@ func (ctrl *ControllerCfg) utilityResgroupConfigGet(rgid int) (*ResgroupConfig,
 	return ret, nil
 }
 
-func utilityResgroupCheckPresence(d *schema.ResourceData, m interface{}) (string, error) {
-	// This function tries to locate resource group by its name and tenant name.
-	// If succeeded, it returns non empty string that contains JSON formatted facts about the 
-	// resource group as returned by cloudspaces/get API call.
-	// Otherwise it returns empty string and meaningful error.
+func utilityResgroupCheckPresence(ctx context.Context, d *schema.ResourceData, m interface{}) (*client.CloudspacesGetResp, error) {
+	// This function locates resource group by its ID if it is known (i.e. the resource group is managed 
+	// by Terraform), otherwise by its name and tenant name (data source).
+	// If succeeded, it returns facts about the resource group as returned by cloudspaces/get API call.
+	// Resource group with known ID that does not exist is reported as nil with no error. Resource group 
+	// that cannot be found by name is reported as nil and meaningful error.
 	//
 	// This function does not modify its ResourceData argument, so it is safe to use it as core
 	// method for the resource's Exists method.
 	//
-	name := d.Get("name").(string)
-	tenant_name := d.Get("tenant").(string)
+	if d.Id() == "" {
+		return utilityResgroupFindByName(ctx, d.Get("tenant").(string), d.Get("name").(string), m)
+	}
+	rgid, err := strconv.Atoi(d.Id())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid resource group ID %q: %s", d.Id(), err)
+	}
+	return utilityResgroupGetByID(ctx, rgid, m)
+}
 
+func utilityResgroupGetByID(ctx context.Context, rgid int, m interface{}) (*client.CloudspacesGetResp, error) {
+	// Return facts about the resource group with the specified ID or nil if there is no such resource group.
 	controller := m.(*ControllerCfg)
-	url_values := &url.Values{}
-	url_values.Add("includedeleted", "false")
-	body_string, err := controller.decsAPICall("POST", CloudspacesListAPI, url_values)
+	rg_facts, err := controller.api.Cloudspaces.Get(ctx, rgid)
 	if err != nil {
-		return "", err
+		if isNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if containsStatus(removedStatuses, rg_facts.Status) {
+		return nil, nil
 	}
+	return rg_facts, nil
+}
 
-	log.Printf("%s", body_string)
-	log.Printf("utilityResgroupCheckPresence: ready to decode response body from %q", CloudspacesListAPI)
-	model := CloudspacesListResp{}
-	err = json.Unmarshal([]byte(body_string), &model)
+func utilityResgroupFindByName(ctx context.Context, tenant_name string, name string, m interface{}) (*client.CloudspacesGetResp, error) {
+	// Return facts about the resource group with the specified name owned by the tenant. Name is 
+	// not guaranteed to be unique, so ambiguous name is reported as error.
+	controller := m.(*ControllerCfg)
+	model, err := controller.api.Cloudspaces.List(ctx, false)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	log.Printf("utilityResgroupCheckPresence: traversing decoded Json of length %d", len(model))
-	for index, item := range model {
+	log.Printf("utilityResgroupFindByName: traversing resource group list of length %d", len(model))
+	var rg_ids []string
+	for _, item := range model {
 		// need to match VDC by name & tenant name
-		if item.Name == name && item.TenantName == tenant_name {
-			log.Printf("utilityResgroupCheckPresence: match ResGroup name %q / ID %d, tenant %q at index %d", 
-					   item.Name, item.ID, item.TenantName, index)
-
-			// not all required information is returned by cloudspaces/list API, so we need to initiate one more
-			// call to cloudspaces/get to obtain extra data to complete Resource population.
-			// Namely, we need to extract resource quota settings
-			req_values := &url.Values{} 
-			req_values.Add("cloudspaceId", fmt.Sprintf("%d", item.ID))
-			body_string, err := controller.decsAPICall("POST", CloudspacesGetAPI, req_values)
-			if err != nil {
-				return "", err
-			}
-
-			return body_string, nil
+		if item.Name == name && item.TenantName == tenant_name && !containsStatus(removedStatuses, item.Status) {
+			rg_ids = append(rg_ids, strconv.Itoa(int(item.ID)))
 		}
 	}
+	if len(rg_ids) > 1 {
+		return nil, fmt.Errorf("Found %d resource groups named %q owned by tenant %q (IDs %s). Use resource group ID to select one of them.", 
+		                       len(rg_ids), name, tenant_name, strings.Join(rg_ids, ", "))
+	}
+	if len(rg_ids) == 1 {
+		// not all required information is returned by cloudspaces/list API, so we need to initiate one more
+		// call to cloudspaces/get to obtain extra data to complete Resource population.
+		// Namely, we need to extract resource quota settings
+		rgid, _ := strconv.Atoi(rg_ids[0])
+		rg_facts, err := utilityResgroupGetByID(ctx, rgid, m)
+		if rg_facts != nil || err != nil {
+			return rg_facts, err
+		}
+		// resource group was deleted after we listed it
+	}
 
-	return "", fmt.Errorf("Cannot find resource group name %q owned by tenant %q", name, tenant_name)
+	return nil, fmt.Errorf("Cannot find resource group name %q owned by tenant %q", name, tenant_name)
 }
 
-func utilityGetTenantIdByName(tenant_name string, m interface{}) (int, error) {
+func utilityGetTenantIdByName(ctx context.Context, tenant_name string, m interface{}) (int, error) {
 	controller := m.(*ControllerCfg)
-	url_values := &url.Values{}
-	body_string, err := controller.decsAPICall("POST", TenantsListAPI, url_values)
+	model, err := controller.api.Accounts.List(ctx)
 	if err != nil {
 		return 0, err
 	}
 
-	model := TenantsListResp{}
-	err = json.Unmarshal([]byte(body_string), &model)
-	if err != nil {
-		return 0, err
-	}
-
-	log.Printf("utilityGetTenantIdByName: traversing decoded Json of length %d", len(model))
+	log.Printf("utilityGetTenantIdByName: traversing tenant list of length %d", len(model))
 	for index, item := range model {
 		// need to match Tenant by name
 		if item.Name == tenant_name {
@@ -136,4 +142,18 @@ func utilityGetTenantIdByName(tenant_name string, m interface{}) (int, error) {
 	}
 
 	return 0, fmt.Errorf("Cannot find tenant %q for the current user. Check tenant value and your access rights", tenant_name)
-}
\ No newline at end of file
+}
+
+func utilityGetTenantNameByID(ctx context.Context, tenant_id int, m interface{}) (string, error) {
+	controller := m.(*ControllerCfg)
+	model, err := controller.api.Accounts.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, item := range model {
+		if item.ID == tenant_id {
+			return item.Name, nil
+		}
+	}
+	return "", fmt.Errorf("Cannot find tenant ID %d for the current user. Check your access rights", tenant_id)
+}
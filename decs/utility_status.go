@@ -0,0 +1,113 @@
+/*
+Copyright (c) 2019-2021 Digital Energy Cloud Solutions LLC. All Rights Reserved.
+Author: Sergey Shubin, <sergey.shubin@digitalenergy.online>, <svs1370@gmail.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package decs
+
+import (
+
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+)
+
+// delay between two consecutive status checks of an object that is in transition
+var statusPollInterval = time.Second * 3
+
+// VM is ready for further configuration when it is either running or stopped
+var vmStableStatuses = []string{"RUNNING", "HALTED"}
+
+// Resource group without VMs may stay VIRTUAL until the first VM is deployed in it, so this
+// status is as good as DEPLOYED for the purpose of further configuration
+var resgroupStableStatuses = []string{"DEPLOYED", "VIRTUAL"}
+
+// object in one of these statuses will never reach stable status
+var failedStatuses = []string{"ERROR", "DESTROYED", "DELETED"}
+
+// Objects in these statuses may still be returned by the controller, but they are as good as gone
+var removedStatuses = []string{"DESTROYED", "DELETED"}
+
+func containsStatus(status_list []string, status string) bool {
+	for _, item := range status_list {
+		if item == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (ctrl *ControllerCfg) waitForStatus(ctx context.Context, object string, get_status func() (string, error), targets []string) error {
+	// Poll status of the object until it reaches one of the target statuses. Return error if the object
+	// ends up in a failed status or if it does not reach target status before the context is done.
+	status := ""
+	for {
+		new_status, err := get_status()
+		if isContextError(err) {
+			return explainAPIError(err, fmt.Sprintf("wait for %s to reach %s status, last seen status %q", 
+			                                        object, strings.Join(targets, " or "), status))
+		}
+		if err != nil {
+			return err
+		}
+		status = new_status
+		if containsStatus(targets, status) {
+			log.Printf("waitForStatus: %s reached status %q", object, status)
+			return nil
+		}
+		if containsStatus(failedStatuses, status) {
+			return fmt.Errorf("%s ended up in %s status while waiting for %s.", object, status, strings.Join(targets, " or "))
+		}
+		log.Printf("waitForStatus: %s is in status %q, waiting for %s", object, status, strings.Join(targets, " or "))
+		if !ctrl.recorder.replaying() {
+			err = sleepContext(ctx, statusPollInterval)
+			if err != nil {
+				return explainAPIError(err, fmt.Sprintf("wait for %s to reach %s status, last seen status %q", 
+				                                        object, strings.Join(targets, " or "), status))
+			}
+		}
+	}
+}
+
+func (ctrl *ControllerCfg) utilityVmWaitForStatus(ctx context.Context, vm_id int) error {
+	// Wait until VM is either running or stopped after a call that changes its configuration.
+	return ctrl.utilityVmWaitForTargetStatus(ctx, vm_id, vmStableStatuses)
+}
+
+func (ctrl *ControllerCfg) utilityVmWaitForTargetStatus(ctx context.Context, vm_id int, targets []string) error {
+	// Wait until VM reaches one of the given statuses, e.g. HALTED after it has been stopped. Stop and start
+	// calls return before the VM changes its status, so waiting for any stable status is not enough there.
+	return ctrl.waitForStatus(ctx, fmt.Sprintf("VM ID %d", vm_id), func() (string, error) {
+		vm_facts, err := ctrl.api.Machines.Get(ctx, vm_id)
+		if err != nil {
+			return "", err
+		}
+		return vm_facts.Status, nil
+	}, targets)
+}
+
+func (ctrl *ControllerCfg) utilityResgroupWaitForStatus(ctx context.Context, rgid int) error {
+	// Wait until resource group is deployed after it has been created.
+	return ctrl.waitForStatus(ctx, fmt.Sprintf("resource group ID %d", rgid), func() (string, error) {
+		rg_facts, err := ctrl.api.Cloudspaces.Get(ctx, rgid)
+		if err != nil {
+			return "", err
+		}
+		return rg_facts.Status, nil
+	}, resgroupStableStatuses)
+}
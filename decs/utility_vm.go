@@ -19,134 +19,296 @@ package decs
 
 import (
 
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/url"
+	"log"
 	"strconv"
+	"strings"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	// "github.com/hashicorp/terraform/helper/validation"
+
+	"github.com/terraform-provider-decs/decs/client"
 )
 
-func (ctrl *ControllerCfg) utilityVmDisksProvision(mcfg *MachineConfig) error {
+func (ctrl *ControllerCfg) utilityVmDisksProvision(ctx context.Context, mcfg *MachineConfig) error {
 	for index, disk := range mcfg.DataDisks {
-		url_values := &url.Values{}
-		// url_values.Add("machineId", fmt.Sprintf("%d", mcfg.ID))
-		url_values.Add("accountId", fmt.Sprintf("%d", mcfg.TenantID))
-		url_values.Add("gid", fmt.Sprintf("%d", mcfg.GridID))
-		url_values.Add("name", fmt.Sprintf("%s", disk.Label))
-		url_values.Add("description", fmt.Sprintf("Data disk for VM ID %d / VM Name: %s", mcfg.ID, mcfg.Name))
-		url_values.Add("size", fmt.Sprintf("%d", disk.Size))
-		url_values.Add("type", "D")
-		// url_values.Add("iops", )
-
-		disk_id_resp, err := ctrl.decsAPICall("POST", DiskCreateAPI, url_values)
-		if err != nil {
-			// failed to create disk - partial resource update
-			return err
+		disk_param := &client.DiskCreateParam{
+			TenantID:    mcfg.TenantID,
+			GridID:      mcfg.GridID,
+			Name:        disk.Label,
+			Description: fmt.Sprintf("Data disk for VM ID %d / VM Name: %s", mcfg.ID, mcfg.Name),
+			Size:        disk.Size,
+			DiskType:    "D",
 		}
-		// disk created - API call returns disk ID as a string - use it to update  
-		// disk ID in the corresponding MachineConfig.DiskConfig record
-
-		mcfg.DataDisks[index].ID, err = strconv.Atoi(disk_id_resp)
+		disk_id, err := ctrl.api.Disks.Create(ctx, disk_param)
 		if err != nil {
-			// failed to convert disk ID into proper integer value - partial resource update
-			return err
+			// failed to create disk - partial resource update
+			return explainAPIError(err, fmt.Sprintf("create data disk %q (%d of %d) for VM ID %d", 
+			                                        disk.Label, index+1, len(mcfg.DataDisks), mcfg.ID))
 		}
+		// disk created - update disk ID in the corresponding MachineConfig.DiskConfig record
+		mcfg.DataDisks[index].ID = disk_id
 
 		// now that we have disk created and stored its ID in the mcfg.DataDisks[index].ID
 		// we can attempt attaching the disk to the VM
-		url_values = &url.Values{}
-		// url_values.Add("machineId", fmt.Sprintf("%d", mcfg.ID))
-		url_values.Add("machineId", fmt.Sprintf("%d", mcfg.ID))
-		url_values.Add("diskId", disk_id_resp)
-		_, err = ctrl.decsAPICall("POST", DiskAttachAPI, url_values)
+		err = ctrl.api.Machines.AttachDisk(ctx, mcfg.ID, disk_id)
 		if err != nil {
 			// failed to attach disk - partial resource update
-			return err
+			return explainAPIError(err, fmt.Sprintf("attach data disk %q (%d of %d) to VM ID %d", 
+			                                        disk.Label, index+1, len(mcfg.DataDisks), mcfg.ID))
 		}
 	}
 	return nil
 }
 
 
-func (ctrl *ControllerCfg) utilityVmPortforwardsProvision(mcfg *MachineConfig) error {
-	for _, rule := range mcfg.PortForwards {
-		url_values := &url.Values{}
-		url_values.Add("machineId", fmt.Sprintf("%d", mcfg.ID))
-		url_values.Add("cloudspaceId", fmt.Sprintf("%d", mcfg.ResGroupID))
-		url_values.Add("publicIp", mcfg.ExtIP) // this may be obsoleted by Resource group implementation 
-		url_values.Add("publicPort", fmt.Sprintf("%d", rule.ExtPort))
-		url_values.Add("localPort", fmt.Sprintf("%d", rule.IntPort))
-		url_values.Add("protocol", rule.Proto)
-		_, err := ctrl.decsAPICall("POST", PortforwardingCreateAPI, url_values)
+func (ctrl *ControllerCfg) utilityVmDisksUpdate(ctx context.Context, mcfg *MachineConfig, removed []DiskConfig, grown []DiskConfig) error {
+	// Bring data disks of existing VM in line with the configuration. Removed disks are detached 
+	// (and deleted unless they are to be kept) first, so that they free their share of the quota 
+	// for the disks being grown or added. Disks to be added are taken from mcfg.DataDisks.
+	for _, disk := range removed {
+		log.Printf("utilityVmDisksUpdate: detaching data disk %q ID %d from VM ID %d", disk.Label, disk.ID, mcfg.ID)
+		err := ctrl.api.Machines.DetachDisk(ctx, mcfg.ID, disk.ID)
+		if err != nil && !isNotFoundError(err) {
+			return explainAPIError(err, fmt.Sprintf("detach data disk %q (ID %d) from VM ID %d", disk.Label, disk.ID, mcfg.ID))
+		}
+		if disk.KeepOnRemove {
+			continue
+		}
+		err = ctrl.api.Disks.Delete(ctx, disk.ID, true)
+		if err != nil && !isNotFoundError(err) {
+			return explainAPIError(err, fmt.Sprintf("delete data disk %q (ID %d) detached from VM ID %d", disk.Label, disk.ID, mcfg.ID))
+		}
+	}
+
+	for _, disk := range grown {
+		log.Printf("utilityVmDisksUpdate: resizing data disk %q ID %d of VM ID %d to %d GB", disk.Label, disk.ID, mcfg.ID, disk.Size)
+		err := ctrl.api.Disks.Resize(ctx, disk.ID, disk.Size)
+		if err != nil {
+			return explainAPIError(err, fmt.Sprintf("resize data disk %q (ID %d) of VM ID %d to %d GB", disk.Label, disk.ID, mcfg.ID, disk.Size))
+		}
+	}
+
+	if len(mcfg.DataDisks) > 0 {
+		// new disks are created in the tenant and grid of the resource group the VM belongs to
+		resgroup, err := ctrl.utilityResgroupConfigGet(ctx, mcfg.ResGroupID)
+		if err != nil {
+			return explainAPIError(err, fmt.Sprintf("read resource group ID %d", mcfg.ResGroupID))
+		}
+		mcfg.TenantID = resgroup.TenantID
+		mcfg.GridID = resgroup.GridID
+		err = ctrl.utilityVmDisksProvision(ctx, mcfg)
 		if err != nil {
-			// failed to create port forward rule - partial resource update
 			return err
 		}
 	}
+
+	// attaching and detaching disks may put the VM into transition for a while
+	return ctrl.utilityVmWaitForStatus(ctx, mcfg.ID)
+}
+
+func (ctrl *ControllerCfg) utilityVmPortforwardsProvision(ctx context.Context, mcfg *MachineConfig) error {
+	for index, rule := range mcfg.PortForwards {
+		pfw_param := &client.PortforwardingCreateParam{
+			ResGroupID: mcfg.ResGroupID,
+			VmID:       mcfg.ID,
+			ExtIP:      mcfg.ExtIP, // this may be obsoleted by Resource group implementation
+			ExtPort:    rule.ExtPort,
+			IntPort:    rule.IntPort,
+			Proto:      rule.Proto,
+		}
+		err := ctrl.api.Portforwarding.Create(ctx, pfw_param)
+		if err != nil {
+			// failed to create port forward rule - partial resource update
+			return explainAPIError(err, fmt.Sprintf("create port forward %d:%d/%s (%d of %d) for VM ID %d", 
+			                                        rule.ExtPort, rule.IntPort, rule.Proto, index+1, len(mcfg.PortForwards), mcfg.ID))
+		}
+	}
 	return nil
 }
 
-func (ctrl *ControllerCfg) utilityVmNetworksProvision(mcfg *MachineConfig) error {
-	for _, net := range mcfg.Networks {
-		url_values := &url.Values{}
-		url_values.Add("machineId", fmt.Sprintf("%d", mcfg.ID))
-		url_values.Add("externalNetworkId", fmt.Sprintf("%d", net.NetworkID))
-		_, err := ctrl.decsAPICall("POST", AttachExternalNetworkAPI, url_values)
+func (ctrl *ControllerCfg) utilityVmPortforwardsReconcile(ctx context.Context, mcfg *MachineConfig) error {
+	// Bring port forwarding rules of the VM in line with mcfg.PortForwards: rules that are not configured 
+	// are deleted, configured rules that are missing are created. Rules are compared by their ports 
+	// and protocol.
+	pfw_list, err := ctrl.api.Portforwarding.List(ctx, mcfg.ResGroupID, mcfg.ID)
+	if err != nil {
+		return explainAPIError(err, fmt.Sprintf("read port forwards of VM ID %d", mcfg.ID))
+	}
+
+	wanted := make(map[string]bool)
+	for _, rule := range mcfg.PortForwards {
+		wanted[portforwardKey(rule.ExtPort, rule.IntPort, rule.Proto)] = true
+	}
+	existing := make(map[string]bool)
+	for _, record := range pfw_list {
+		ext_port, _ := strconv.Atoi(record.ExtPort)
+		int_port, _ := strconv.Atoi(record.IntPort)
+		key := portforwardKey(ext_port, int_port, record.Proto)
+		existing[key] = true
+		if wanted[key] {
+			continue
+		}
+		log.Printf("utilityVmPortforwardsReconcile: deleting port forward %s ID %d of VM ID %d", key, record.ID, mcfg.ID)
+		err = ctrl.api.Portforwarding.Delete(ctx, mcfg.ResGroupID, record.ID)
+		if err != nil && !isNotFoundError(err) {
+			return explainAPIError(err, fmt.Sprintf("delete port forward %s (ID %d) of VM ID %d", key, record.ID, mcfg.ID))
+		}
+	}
+
+	var missing []PortforwardConfig
+	for _, rule := range mcfg.PortForwards {
+		if !existing[portforwardKey(rule.ExtPort, rule.IntPort, rule.Proto)] {
+			missing = append(missing, rule)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// rules are created on the external IP address of the resource group the VM belongs to
+	resgroup, err := ctrl.utilityResgroupConfigGet(ctx, mcfg.ResGroupID)
+	if err != nil {
+		return explainAPIError(err, fmt.Sprintf("read resource group ID %d", mcfg.ResGroupID))
+	}
+	mcfg.ExtIP = resgroup.ExtIP
+	mcfg.PortForwards = missing
+	return ctrl.utilityVmPortforwardsProvision(ctx, mcfg)
+}
+
+func (ctrl *ControllerCfg) utilityVmNetworksProvision(ctx context.Context, mcfg *MachineConfig) error {
+	for index, net := range mcfg.Networks {
+		err := ctrl.api.Machines.AttachExternalNetwork(ctx, mcfg.ID, net.NetworkID)
 		if err != nil {
 			// failed to attach network - partial resource update
-			return err
+			return explainAPIError(err, fmt.Sprintf("attach external network ID %d (%d of %d) to VM ID %d", 
+			                                        net.NetworkID, index+1, len(mcfg.Networks), mcfg.ID))
 		}
 	}
 	return nil
 }
 
-func utilityVmCheckPresence(d *schema.ResourceData, m interface{}) (string, error) {
-	// This function tries to locate VM by its name and resource group ID
-	// if succeeded, it returns non empty string that contains JSON formatted facts about the VM
-	// as returned by machines/get API call.
-	// Otherwise it returns empty string and meaningful error.
+func (ctrl *ControllerCfg) utilityVmResize(ctx context.Context, vm_id int, cpu int, ram int, allow_stop bool) error {
+	// Change CPU count and RAM size of the VM. Controller may refuse to resize running VM, in which case
+	// the VM is stopped for resize and started again, but only if the user allowed it.
+	action := fmt.Sprintf("resize VM ID %d to %d CPU and %d MB RAM", vm_id, cpu, ram)
+	resize_param := &client.MachineResizeParam{
+		MachineID: vm_id,
+		Cpu:       cpu,
+		Ram:       ram,
+	}
+	err := ctrl.api.Machines.Resize(ctx, resize_param)
+	if err == nil {
+		return ctrl.utilityVmWaitForStatus(ctx, vm_id)
+	}
+	if apiErrorKind(err) != API_ERR_CONFLICT {
+		return explainAPIError(err, action)
+	}
+	// Conflict also means that the VM is busy, e.g. still being deployed - stopping helps only if it is running
+	vm_facts, get_err := ctrl.api.Machines.Get(ctx, vm_id)
+	if get_err != nil {
+		return explainAPIError(get_err, fmt.Sprintf("check status of VM ID %d after failed resize", vm_id))
+	}
+	if vm_facts.Status != "RUNNING" {
+		return fmt.Errorf("Cannot %s: DECS controller refused to resize VM in status %s. %s", action, vm_facts.Status, err)
+	}
+	if !allow_stop {
+		return fmt.Errorf("Cannot %s: DECS controller requires the VM to be stopped for resize. Set allow_stop_for_update = true to let the provider stop and restart it. %s", 
+		                  action, err)
+	}
+
+	log.Printf("utilityVmResize: stopping VM ID %d for resize", vm_id)
+	err = ctrl.api.Machines.Stop(ctx, vm_id)
+	if err != nil {
+		return explainAPIError(err, fmt.Sprintf("stop VM ID %d for resize", vm_id))
+	}
+	err = ctrl.utilityVmWaitForTargetStatus(ctx, vm_id, []string{"HALTED"})
+	if err != nil {
+		return err
+	}
+
+	resize_err := ctrl.api.Machines.Resize(ctx, resize_param)
+	// VM is started again even if resize failed, so that it is not left stopped because of the failure
+	log.Printf("utilityVmResize: starting VM ID %d after resize", vm_id)
+	err = ctrl.api.Machines.Start(ctx, vm_id)
+	if err == nil {
+		err = ctrl.utilityVmWaitForTargetStatus(ctx, vm_id, []string{"RUNNING"})
+	}
+	if resize_err != nil {
+		if err != nil {
+			log.Printf("utilityVmResize: failed to start VM ID %d after failed resize: %s", vm_id, err)
+		}
+		return explainAPIError(resize_err, action)
+	}
+	if err != nil {
+		return explainAPIError(err, fmt.Sprintf("start VM ID %d after resize", vm_id))
+	}
+	return nil
+}
+
+func utilityVmCheckPresence(ctx context.Context, d *schema.ResourceData, m interface{}) (*client.MachinesGetResp, error) {
+	// This function locates VM by its ID if it is known (i.e. the VM is managed by Terraform), otherwise
+	// by its name and resource group ID (data source). Name is not used to locate VM with known ID,
+	// as name can be changed in place.
+	// If succeeded, it returns facts about the VM as returned by machines/get API call.
+	// If VM does not exist, it returns nil and no error. Otherwise it returns nil and meaningful error.
 	//
 	// This function does not modify its ResourceData argument, so it is safe to use it as core
 	// method for resource's Exists method.
 	//
-	name := d.Get("name").(string)
-	rgid := d.Get("rgid").(int)
+	if d.Id() == "" {
+		return utilityVmFindByName(ctx, d.Get("rgid").(int), d.Get("name").(string), m)
+	}
+	vm_id, err := strconv.Atoi(d.Id())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid VM ID %q: %s", d.Id(), err)
+	}
+	return utilityVmGetByID(ctx, vm_id, m)
+}
 
+func utilityVmGetByID(ctx context.Context, vm_id int, m interface{}) (*client.MachinesGetResp, error) {
+	// Return facts about the VM with the specified ID or nil if there is no such VM.
 	controller := m.(*ControllerCfg)
-	list_url_values := &url.Values{}
-	list_url_values.Add("cloudspaceId", fmt.Sprintf("%d",rgid))
-	body_string, err := controller.decsAPICall("POST", MachinesListAPI, list_url_values)
+	vm_facts, err := controller.api.Machines.Get(ctx, vm_id)
 	if err != nil {
-		return "", err
+		if isNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if containsStatus(removedStatuses, vm_facts.Status) {
+		return nil, nil
 	}
+	return vm_facts, nil
+}
 
-	// log.Printf("%s", body_string)
-	// log.Printf("dataSourceVmRead: ready to decode mashines/list response body")
-	vm_list := MachinesListResp{}
-	err = json.Unmarshal([]byte(body_string), &vm_list)
+func utilityVmFindByName(ctx context.Context, rgid int, name string, m interface{}) (*client.MachinesGetResp, error) {
+	// Return facts about the VM with the specified name in the resource group or nil if there is 
+	// no such VM. Name is not guaranteed to be unique, so ambiguous name is reported as error.
+	controller := m.(*ControllerCfg)
+	vm_list, err := controller.api.Machines.List(ctx, rgid)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// log.Printf("%#v", vm_list)
-	// log.Printf("dataSourceVmRead: traversing decoded JSON of length %d", len(vm_list))
+	log.Printf("utilityVmFindByName: traversing VM list of length %d", len(vm_list))
+	var vm_ids []string
 	for _, item := range vm_list {
 		// need to match VM by name, skip VMs with the same name in DESTROYED satus
-		if item.Name == name && item.Status != "DESTROYED" {
-			// log.Printf("dataSourceVmRead: index %d, matched name %q", index, item.Name)
-			// we found the VM we need - not get detailed information via API call to cloudapi/machines/get
-			get_url_values := &url.Values{}
-			get_url_values.Add("machineId", fmt.Sprintf("%d", item.ID))
-			body_string, err = controller.decsAPICall("POST", MachinesGetAPI, get_url_values)
-			if err != nil {
-				return "", err
-			}
-			return body_string, nil
-		}
-	}
-
-	return "", nil // there should be no error if VM does not exist
-	// return "", fmt.Errorf("Cannot find VM name %q in resource group ID %d", name, rgid)
-}
\ No newline at end of file
+		if item.Name == name && !containsStatus(removedStatuses, item.Status) {
+			vm_ids = append(vm_ids, strconv.Itoa(int(item.ID)))
+		}
+	}
+	if len(vm_ids) == 0 {
+		return nil, nil // there should be no error if VM does not exist
+	}
+	if len(vm_ids) > 1 {
+		return nil, fmt.Errorf("Found %d VMs named %q in resource group ID %d (IDs %s). Use VM ID to select one of them.", 
+		                       len(vm_ids), name, rgid, strings.Join(vm_ids, ", "))
+	}
+
+	// we found the VM we need - now get detailed information via API call to cloudapi/machines/get
+	vm_id, _ := strconv.Atoi(vm_ids[0])
+	return utilityVmGetByID(ctx, vm_id, m)
+}
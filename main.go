@@ -43,4 +43,7 @@ func main() {
 			return decs.Provider()
 		},
 	})
+	// the provider logs API summary when Terraform asks it to stop, otherwise it is logged here if
+	// plugin.Serve returns when Terraform shuts the provider down at the end of the run
+	decs.LogAPISummary()
 }